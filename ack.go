@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ackPolicy is the one place that decides what status a delivery is answered
+// with, err being whatever processing it ended in. providers only look at
+// the status class:
+//
+//   - 2xx stops them. processed, ignored and duplicate deliveries all get a
+//     200, there's nothing more for the sender to do
+//   - 4xx means the delivery itself is at fault (bad signature, unreadable
+//     or invalid payload). providers still retry these but the same bytes
+//     will fail the same way, so it shows up as failing on their side
+//   - 5xx means we couldn't deal with it right now (timeouts, storage,
+//     forwarding under ack-on-success) and the retry is what we want
+func ackPolicy(err error) int {
+	var (
+		validationErr *ValidationError
+		fwdErr        *ForwardError
+	)
+
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.As(err, &validationErr):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled):
+		// nobody is left to hear it
+		return statusClientClosedRequest
+	case errors.As(err, &fwdErr):
+		return http.StatusBadGateway
+	case errors.Is(err, ErrInvalidSignature):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrInvalidPayload), errors.Is(err, ErrEventTooOld), errors.Is(err, ErrEventInFuture):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+)
+
+// adminRealm is the realm browsers show in the basic auth prompt
+const adminRealm = "webhook admin"
+
+// BasicAuth guards admin routes with a single user and password. without
+// credentials configured every request is turned away, the admin routes
+// stay closed rather than open by default
+func BasicAuth(l *slog.Logger, user, pass string) func(http.Handler) http.Handler {
+	// hashing first keeps the compare constant time even when the lengths
+	// differ
+	wantUser, wantPass := sha256.Sum256([]byte(user)), sha256.Sum256([]byte(pass))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotUser, gotPass, ok := r.BasicAuth()
+
+			userHash, passHash := sha256.Sum256([]byte(gotUser)), sha256.Sum256([]byte(gotPass))
+			userOK := subtle.ConstantTimeCompare(userHash[:], wantUser[:])
+			passOK := subtle.ConstantTimeCompare(passHash[:], wantPass[:])
+
+			if !ok || user == "" || userOK&passOK != 1 {
+				l.Info("rejected admin request with missing or wrong credentials", "path", r.URL.Path, "remote addr", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Basic realm="`+adminRealm+`", charset="UTF-8"`)
+				writeError(w, l, APIError{Code: http.StatusUnauthorized, Message: "unauthorized"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchForwarder collects events and sends them downstream as one JSON array
+// once size events are waiting or interval has passed, whichever is first
+type BatchForwarder struct {
+	next       *HTTPForwarder
+	l          *slog.Logger
+	size       int
+	interval   time.Duration
+	maxPending int
+
+	mu      sync.Mutex
+	pending []forwardedEvent
+	// rejected counts events turned away because maxPending were waiting
+	rejected atomic.Int64
+
+	dead deadLetters
+
+	// ctx covers every send, Close cancels it once its own ctx is done so
+	// a send can't outlive shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	flush  chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewBatchForwarder starts flushing batches through next in the background.
+// at most maxPending events wait to be sent, while the downstream is
+// failing more than that are turned away, and the latest deadLetterSize
+// dead letters are kept
+func NewBatchForwarder(l *slog.Logger, next *HTTPForwarder, size int, interval time.Duration, maxPending, deadLetterSize int) *BatchForwarder {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &BatchForwarder{
+		next:       next,
+		l:          l,
+		size:       size,
+		interval:   interval,
+		maxPending: maxPending,
+		dead:       deadLetters{max: deadLetterSize},
+		ctx:        ctx,
+		cancel:     cancel,
+		flush:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.run()
+
+	return b
+}
+
+// Forward adds the event to the current batch, it is sent later so ctx only
+// covers adding it. with maxPending events already waiting it goes straight
+// to the dead letters instead
+func (b *BatchForwarder) Forward(ctx context.Context, event string, payload any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ev := forwardedEvent{Event: event, Data: payload}
+
+	b.mu.Lock()
+	if len(b.pending) >= b.maxPending {
+		b.mu.Unlock()
+
+		b.rejected.Add(1)
+		b.deadLetter([]forwardedEvent{ev}, 0, ErrForwardQueueFull)
+		return ErrForwardQueueFull
+	}
+	b.pending = append(b.pending, ev)
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.flush <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (b *BatchForwarder) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			b.send()
+			return
+		case <-ticker.C:
+			b.send()
+		case <-b.flush:
+			b.send()
+		}
+	}
+}
+
+// send posts whatever is pending, several batches if more than size piled
+// up in the meantime
+func (b *BatchForwarder) send() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	for len(pending) > 0 {
+		n := min(b.size, len(pending))
+		batch := pending[:n]
+		pending = pending[n:]
+
+		body, err := json.Marshal(batch)
+		if err != nil {
+			b.l.Error("error encoding event batch", "events", len(batch), "error context", err)
+			continue
+		}
+
+		if err := b.next.send(b.ctx, fmt.Sprintf("batch of %d events", len(batch)), body); err != nil {
+			// the senders were already told yes, so every event is kept
+			// to be pushed by hand
+			b.l.Error("error forwarding event batch, dead lettering it", "events", len(batch), "error context", err)
+			b.deadLetter(batch, b.next.retries+1, err)
+			continue
+		}
+
+		b.l.Info("forwarded event batch", "events", len(batch))
+	}
+}
+
+// deadLetter records every event of a batch that wasn't sent, they share the
+// batch's attempts and error
+func (b *BatchForwarder) deadLetter(batch []forwardedEvent, attempts int, err error) {
+	failedAt := time.Now().UTC()
+	for _, ev := range batch {
+		b.dead.add(DeadLetter{
+			ID:       newUUID(),
+			Event:    ev.Event,
+			Payload:  ev.Data,
+			Attempts: attempts,
+			Error:    err.Error(),
+			FailedAt: failedAt,
+		})
+	}
+}
+
+// DeadLetters returns the events of batches that exhausted their retries,
+// and the ones turned away while the backlog was full, oldest first
+func (b *BatchForwarder) DeadLetters() []DeadLetter {
+	return b.dead.list()
+}
+
+// DeadLettersDropped counts the dead letters pushed off the list to make
+// room for newer ones
+func (b *BatchForwarder) DeadLettersDropped() int64 {
+	return b.dead.dropped.Load()
+}
+
+// Rejected counts the events turned away because the backlog was full
+func (b *BatchForwarder) Rejected() int64 {
+	return b.rejected.Load()
+}
+
+// Close sends the events still waiting and stops the background flushes.
+// once ctx is done the send in progress is cancelled, whatever it didn't
+// get downstream is dead lettered before Close returns
+func (b *BatchForwarder) Close(ctx context.Context) error {
+	close(b.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(stopped)
+	}()
+	defer b.cancel()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-stopped
+		return ctx.Err()
+	}
+}
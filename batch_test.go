@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// hangingDownstream accepts batches but never answers until the test ends
+func hangingDownstream(t *testing.T) string {
+	t.Helper()
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		srv.Close()
+	})
+
+	return srv.URL
+}
+
+func TestBatchForwarderCapsPending(t *testing.T) {
+	l := discardLogger()
+	b := NewBatchForwarder(l, NewHTTPForwarder(l, hangingDownstream(t), 0, time.Second), 100, time.Hour, 3, 10)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		b.Close(ctx)
+	}()
+
+	for i := 0; i < 5; i++ {
+		err := b.Forward(context.Background(), "charge.success", fmt.Sprint(i))
+		if want := i >= 3; errors.Is(err, ErrForwardQueueFull) != want {
+			t.Errorf("forward %d: got %v, want the backlog full: %v", i, err, want)
+		}
+	}
+
+	if got := b.Rejected(); got != 2 {
+		t.Errorf("rejected %d events, want 2", got)
+	}
+	if dead := b.DeadLetters(); len(dead) != 2 || dead[0].Payload != "3" || dead[1].Payload != "4" {
+		t.Errorf("dead letters %+v, want the two turned away", dead)
+	}
+}
+
+func TestBatchForwarderCloseCancelsTheLastSend(t *testing.T) {
+	l := discardLogger()
+	b := NewBatchForwarder(l, NewHTTPForwarder(l, hangingDownstream(t), 0, time.Minute), 100, time.Hour, 100, 10)
+
+	if err := b.Forward(context.Background(), "charge.success", "waiting"); err != nil {
+		t.Fatalf("forwarding: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := b.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the close deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close took %s, the last send outlived its deadline", elapsed)
+	}
+
+	// Close waited for the cancelled send, so the event is already kept
+	if dead := b.DeadLetters(); len(dead) != 1 || dead[0].Payload != "waiting" {
+		t.Errorf("dead letters %+v, want the event the cancelled send carried", dead)
+	}
+}
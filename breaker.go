@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker.Forward without calling the
+// downstream, it has failed too often lately to be worth a try
+var ErrCircuitOpen = errors.New("forward circuit is open")
+
+// breakerState is where a CircuitBreaker stands, the values are what the
+// forward_circuit_state gauge reports
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops calling a failing downstream. it opens after
+// threshold failures in a row and fails every forward with ErrCircuitOpen
+// until cooldown has passed, then lets a single forward through as a
+// probe: the breaker closes if it works and opens again if it doesn't
+type CircuitBreaker struct {
+	next      Forwarder
+	threshold int
+	cooldown  time.Duration
+	clock     Clock
+	l         *slog.Logger
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func NewCircuitBreaker(l *slog.Logger, next Forwarder, threshold int, cooldown time.Duration, clock Clock) *CircuitBreaker {
+	return &CircuitBreaker{next: next, threshold: threshold, cooldown: cooldown, clock: clock, l: l}
+}
+
+func (b *CircuitBreaker) Forward(ctx context.Context, event string, payload any) error {
+	if !b.allow() {
+		return ErrCircuitOpen
+	}
+
+	err := b.next.Forward(ctx, event, payload)
+	// our own deadline or cancellation says nothing about the downstream,
+	// but a half-open breaker still needs its probe settled
+	if err != nil && ctx.Err() != nil {
+		b.mu.Lock()
+		if b.state == breakerHalfOpen {
+			b.setState(breakerOpen)
+		}
+		b.mu.Unlock()
+		return err
+	}
+
+	b.record(err)
+	return err
+}
+
+// allow reports whether a forward may go through, moving an open breaker
+// whose cooldown is over to half-open
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		// this forward is the probe, everyone else waits on its outcome
+		b.setState(breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.setState(breakerOpen)
+	}
+}
+
+// setState expects b.mu to be held
+func (b *CircuitBreaker) setState(s breakerState) {
+	if s == breakerOpen {
+		b.openedAt = b.clock.Now()
+	}
+
+	b.l.Warn("forward circuit changed state", "from", b.state.String(), "to", s.String(), "failures", b.failures, "cooldown", b.cooldown)
+	b.state = s
+}
+
+// State returns where the breaker currently stands
+func (b *CircuitBreaker) State() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
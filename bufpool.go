@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer keeps the odd huge body from pinning its buffer in the
+// pool for good
+const maxPooledBuffer = 1 << 20
+
+var bodyBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// readBody reads r into a pooled buffer and returns a copy sized to fit.
+// io.ReadAll grows its slice a few times on the way to the final size, the
+// pooled buffer has usually grown enough already. the copy is what callers
+// get because the body outlives the request in the store and the recent
+// events buffer, nothing may hold on to pooled memory
+func readBody(r io.Reader) ([]byte, error) {
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			bodyBuffers.Put(buf)
+		}
+	}()
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return bytes.Clone(buf.Bytes()), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadBodyCopiesOutOfThePool(t *testing.T) {
+	first, err := readBody(strings.NewReader("first body"))
+	if err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+	if _, err := readBody(strings.NewReader("second body, and longer")); err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+
+	if string(first) != "first body" {
+		t.Errorf("first body changed to %q after the buffer went back to the pool", first)
+	}
+}
+
+func BenchmarkReadBody(b *testing.B) {
+	readers := []struct {
+		name string
+		read func(io.Reader) ([]byte, error)
+	}{
+		{"readBody", readBody},
+		{"io.ReadAll", io.ReadAll},
+	}
+
+	for _, size := range []int{1 << 10, 16 << 10, 256 << 10} {
+		body := bytes.Repeat([]byte("x"), size)
+
+		for _, r := range readers {
+			b.Run(fmt.Sprintf("%s/%dKiB", r.name, size>>10), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+
+				for i := 0; i < b.N; i++ {
+					if _, err := r.read(bytes.NewReader(body)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// capturedHeaders are never written to a capture file, they carry
+// signatures and credentials
+var capturedHeaders = map[string]bool{
+	"Authorization":        true,
+	"Cookie":               true,
+	"X-Paystack-Signature": true,
+	"Stripe-Signature":     true,
+	formSignatureHeader:    true,
+}
+
+// capturedResponsePaths are redacted in response bodies on top of the
+// configured paths, our answers carry the payer in the normalized shape
+// (wrapped in result for dry runs) rather than the provider's
+var capturedResponsePaths = []string{"customer", "result.customer"}
+
+// Capturer writes request/response pairs to a directory, one JSON file each.
+// it is meant for debugging a provider integration, the payloads are
+// redacted but still best kept off production
+type Capturer struct {
+	dir         string
+	max         int
+	redactPaths []string
+	clock       Clock
+
+	mu    sync.Mutex
+	files []string
+}
+
+// NewCapturer keeps at most max capture files in dir, the oldest are
+// removed as new ones come in. files already in dir count towards max
+func NewCapturer(dir string, max int, redactPaths []string, clock Clock) (*Capturer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating capture directory: %w", err)
+	}
+
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("listing capture directory: %w", err)
+	}
+	// names start with the capture time so they sort oldest first
+	sort.Strings(existing)
+
+	return &Capturer{dir: dir, max: max, redactPaths: redactPaths, clock: clock, files: existing}, nil
+}
+
+// capturedMessage is one side of an exchange, Body is left out when empty
+type capturedMessage struct {
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+type capture struct {
+	RequestID  string          `json:"request_id"`
+	CapturedAt time.Time       `json:"captured_at"`
+	Method     string          `json:"method"`
+	URL        string          `json:"url"`
+	Status     int             `json:"status"`
+	Request    capturedMessage `json:"request"`
+	Response   capturedMessage `json:"response"`
+}
+
+func (c *Capturer) message(h http.Header, body []byte, redactPaths []string) capturedMessage {
+	msg := capturedMessage{Headers: make(map[string]string, len(h))}
+	for k, v := range h {
+		if capturedHeaders[k] {
+			msg.Headers[k] = redactedValue
+			continue
+		}
+		msg.Headers[k] = strings.Join(v, ", ")
+	}
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		if mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mediaType == formMediaType {
+			msg.Body = redactForm(body, redactPaths)
+		} else {
+			msg.Body = redactJSON(body, redactPaths)
+		}
+	}
+
+	return msg
+}
+
+func (c *Capturer) write(rec capture) error {
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the request id comes from the caller's X-Request-ID, so it stays in
+	// the file and out of its name
+	name := filepath.Join(c.dir, rec.CapturedAt.Format("20060102T150405.000000000Z")+"-"+newUUID()+".json")
+	if filepath.Dir(name) != filepath.Clean(c.dir) {
+		return fmt.Errorf("capture file %q escapes %q", name, c.dir)
+	}
+
+	if err := os.WriteFile(name, b, 0o600); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.files = append(c.files, name)
+	for len(c.files) > c.max {
+		if err := os.Remove(c.files[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.files = c.files[1:]
+	}
+
+	return nil
+}
+
+// captureWriter keeps a copy of the response body on its way out
+type captureWriter struct {
+	*statusRecorder
+	body bytes.Buffer
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	cw.body.Write(b)
+	return cw.statusRecorder.Write(b)
+}
+
+// Capture records every request passing through it with c, a nil c turns
+// capturing off. failing to write a capture never fails the request
+func Capture(l *slog.Logger, c *Capturer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if c == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var reqBody bytes.Buffer
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, &reqBody), r.Body}
+
+			cw := &captureWriter{statusRecorder: newStatusRecorder(w)}
+			next.ServeHTTP(cw, r)
+
+			rec := capture{
+				RequestID:  requestIDFromContext(r.Context()),
+				CapturedAt: c.clock.Now().UTC(),
+				Method:     r.Method,
+				URL:        r.URL.String(),
+				Status:     cw.status,
+				Request:    c.message(r.Header, reqBody.Bytes(), c.redactPaths),
+				Response:   c.message(cw.Header(), cw.body.Bytes(), append(capturedResponsePaths, c.redactPaths...)),
+			}
+
+			if err := c.write(rec); err != nil {
+				l.Warn("error writing debug capture", "error context", err)
+			}
+		})
+	}
+}
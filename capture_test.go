@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureOne runs req through Capture and returns the capture file written
+func captureOne(t *testing.T, req *http.Request) capture {
+	t.Helper()
+
+	dir := t.TempDir()
+	c, err := NewCapturer(dir, 10, defaultRedactPaths, realClock{})
+	if err != nil {
+		t.Fatalf("creating capturer: %v", err)
+	}
+
+	h := Capture(discardLogger(), c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		writeJSON(w, discardLogger(), http.StatusOK, map[string]string{"status": "ok"})
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("wrote %d capture files, want 1", len(files))
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec capture
+	if err := json.Unmarshal(b, &rec); err != nil {
+		t.Fatalf("decoding capture: %v", err)
+	}
+
+	return rec
+}
+
+func TestCaptureRedactsFormBodies(t *testing.T) {
+	form := url.Values{
+		"payload": {`{"event":"charge.success","data":{"reference":"ref_1","customer":{"email":"jo@example.com"}}}`},
+		"source":  {"legacy"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/dynamic-hook/legacy", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", formMediaType)
+	req.Header.Set(formSignatureHeader, "deadbeef")
+
+	rec := captureOne(t, req)
+
+	if got := rec.Request.Headers[formSignatureHeader]; got != redactedValue {
+		t.Errorf("%s captured as %q", formSignatureHeader, got)
+	}
+
+	var body struct {
+		Payload struct {
+			Event string `json:"event"`
+			Data  struct {
+				Reference string `json:"reference"`
+				Customer  struct {
+					Email string `json:"email"`
+				} `json:"customer"`
+			} `json:"data"`
+		} `json:"payload"`
+		Source string `json:"source"`
+	}
+	if err := json.Unmarshal(rec.Request.Body, &body); err != nil {
+		t.Fatalf("captured form body isn't readable: %v: %s", err, rec.Request.Body)
+	}
+
+	if body.Payload.Event != "charge.success" || body.Payload.Data.Reference != "ref_1" || body.Source != "legacy" {
+		t.Errorf("fields lost in the capture: %s", rec.Request.Body)
+	}
+	if body.Payload.Data.Customer.Email != redactedValue {
+		t.Errorf("customer email captured as %q", body.Payload.Data.Customer.Email)
+	}
+}
+
+func TestRedactForm(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"field named by a path", "email=jo%40example.com&ref=1", `{"email":"[REDACTED]","ref":"1"}`},
+		{"repeated field", "tag=a&tag=b", `{"tag":["a","b"]}`},
+		{"json field", `payload=%7B%22email%22%3A%22jo%22%7D`, `{"payload":{"email":"[REDACTED]"}}`},
+		{"broken json field", `payload=%7Bnope`, `{"payload":"[REDACTED]"}`},
+		{"not a form", "%zz", `"[REDACTED]"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(redactForm([]byte(tt.raw), []string{"email"})); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseCIDRs parses a comma separated list of CIDR ranges, a bare IP is
+// taken as a range holding just that address
+func parseCIDRs(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// ProxyTrust says which hops in front of us may be believed about where a
+// request came from, the zero value trusts nobody and uses RemoteAddr
+type ProxyTrust struct {
+	// Proxies are the ranges our own reverse proxies live in
+	Proxies []*net.IPNet
+	// Peer trusts whatever connected to us directly, it's what
+	// TRUST_FORWARDED_FOR turns on
+	Peer bool
+}
+
+func (t ProxyTrust) trusts(ip net.IP) bool {
+	for _, n := range t.Proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP is the address a request came from. when it arrived through a
+// trusted proxy that is the right-most X-Forwarded-For hop that isn't one of
+// our proxies, anything left of it was sent by the client and can be forged.
+// X-Real-IP is used when a trusted proxy sends no X-Forwarded-For
+func clientIP(r *http.Request, trust ProxyTrust) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !(trust.Peer || trust.trusts(ip)) {
+		return ip
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	if len(hops) == 0 {
+		if real := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); real != nil {
+			return real
+		}
+		return ip
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// garbage only comes from the client, the last hop we
+			// believed is as close as we get
+			return ip
+		}
+
+		ip = hop
+		if !trust.trusts(hop) {
+			return hop
+		}
+	}
+
+	// every hop is one of ours, so the request started at the left-most
+	return ip
+}
+
+// AllowCIDRs answers requests from outside nets with a 403, an empty list
+// lets everything through. the source is worked out with clientIP
+func AllowCIDRs(l *slog.Logger, nets []*net.IPNet, trust ProxyTrust) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(nets) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r, trust)
+			for _, n := range nets {
+				if ip != nil && n.Contains(ip) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			l.Info("rejected request from a source outside the allowed ranges", "source ip", ip, "remote addr", r.RemoteAddr)
+			writeError(w, l, APIError{Code: http.StatusForbidden, Message: "source address not allowed"})
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "time"
+
+// Clock tells the time, everything that makes decisions on the wall clock
+// (event age, TTLs, uptime) takes one so tests can control it. durations
+// that are only measured, like handler latency, stay on time.Now
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
@@ -0,0 +1,687 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds everything the server needs, it is loaded once at startup
+type Config struct {
+	// Addr is the address the server listens on
+	Addr string
+	// InternalAddr moves the admin and metrics routes (/metrics, /events,
+	// /debug, /stats, /deadletter) to a listener of their own so they can
+	// be kept off the public network. they share Addr when it's empty
+	InternalAddr string
+	// PaystackSecret is used to verify webhook signatures, it or
+	// PaystackSecrets is required. it's read from PAYSTACK_SECRET_FILE
+	// when that's set and PAYSTACK_SECRET otherwise
+	PaystackSecret string
+	// PaystackSecrets are more keys accepted while the secret is being
+	// rotated, a delivery signed with any of them is valid
+	PaystackSecrets []string
+	// StripeSecret is the Stripe endpoint signing secret, the stripe
+	// provider is only mounted when it's set
+	StripeSecret string
+	// LegacySecret is the signing secret of the legacy provider that posts
+	// form encoded webhooks, it is only mounted when it's set
+	LegacySecret string
+	// TLSCertFile and TLSKeyFile make the server speak HTTPS (and HTTP/2)
+	// itself, it serves plain HTTP when they're unset
+	TLSCertFile string
+	TLSKeyFile  string
+	// ShutdownTimeout is how long in-flight requests get to drain on shutdown
+	ShutdownTimeout time.Duration
+	// RoutePrefix is prepended to every route, e.g. /webhooks when mounted
+	// under that path behind a reverse proxy
+	RoutePrefix string
+	// MaxBodyBytes caps the size of a webhook body
+	MaxBodyBytes int64
+	// MaxHeaderBytes caps the size of the request line and headers,
+	// 64KiB by default. net/http answers anything bigger with a 431, give
+	// or take the 4KiB of slack it adds on top
+	MaxHeaderBytes int
+	// MaxHeaderCount caps how many header lines a request may carry
+	MaxHeaderCount int
+	// ReadHeaderTimeout bounds reading the request headers, 5s by default.
+	// it is the main defence against slowloris style clients
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading the whole request including the body,
+	// 15s by default
+	ReadTimeout time.Duration
+	// WriteTimeout bounds everything after the headers were read up to the
+	// end of the response, 30s by default so a forward with retries fits
+	WriteTimeout time.Duration
+	// RequestTimeout bounds the work done for a single request, storing
+	// and forwarding included, 10s by default and 0 turns it off
+	RequestTimeout time.Duration
+	// IdleTimeout is how long a keep-alive connection may sit unused,
+	// 60s by default
+	IdleTimeout time.Duration
+	// HealthStatus is the status /health reports, "ok" by default
+	HealthStatus string
+	// PrettyJSON indents JSON responses, it's meant for local debugging
+	// and off by default
+	PrettyJSON bool
+	// LogFormat is either "text" or "json"
+	LogFormat string
+	// LogLevel is the minimum level that gets logged
+	LogLevel slog.Level
+	// LogOutput is where logs go, "stdout" (the default), "stderr" or the
+	// path of a file to append to
+	LogOutput string
+	// LogMaxSize is how many bytes a log file may grow to before it's
+	// rotated, 0 never rotates. it has no effect on stdout and stderr
+	LogMaxSize int64
+	// LogMaxBackups is how many rotated log files are kept, 5 by default
+	LogMaxBackups int
+	// IdempotencyTTL is how long a processed delivery is remembered
+	IdempotencyTTL time.Duration
+	// DatabaseURL is the SQLite file path or DSN events are stored in,
+	// events stay in memory when it's empty. sqlite DSNs get busy_timeout
+	// and WAL pragmas unless they set their own
+	DatabaseURL string
+	// DatabaseDriver is the database/sql driver name used with DatabaseURL
+	DatabaseDriver string
+	// MemoryStoreSize is how many events are kept when there's no
+	// DatabaseURL, the oldest are dropped first
+	MemoryStoreSize int
+	// MaxEventAge is how far data.created_at may be from now before a
+	// delivery is rejected, 0 (the default) turns the check off. paystack
+	// sets created_at when the resource is created, not when the delivery
+	// is sent, so paid requests and retries can be much older than this
+	MaxEventAge time.Duration
+	// StrictDecode rejects event payloads carrying fields we don't know
+	// about with a 422 instead of ignoring them
+	StrictDecode bool
+	// AllowedCurrencies limits which currencies payments may be in, every
+	// currency is accepted when it's empty
+	AllowedCurrencies CurrencyAllowList
+	// AllowedCIDRs are the ranges webhooks may come from, e.g. the
+	// provider's published IPs, any source is accepted when it's empty
+	AllowedCIDRs []*net.IPNet
+	// TrustProxy are the ranges of the reverse proxies in front of us,
+	// requests arriving through them are attributed to the right-most
+	// X-Forwarded-For (or X-Real-IP) address outside these ranges
+	TrustProxy []*net.IPNet
+	// TrustForwardedFor trusts whatever connects to us directly, so the
+	// source is the last X-Forwarded-For entry. only turn it on when
+	// every connection comes through a proxy that sets the header,
+	// TrustProxy is the safer choice
+	TrustForwardedFor bool
+	// RateLimit is how many webhooks per second a single source may send,
+	// 0 turns rate limiting off
+	RateLimit float64
+	// RateBurst is how many webhooks a source may send at once before
+	// RateLimit kicks in
+	RateBurst int
+	// OTLPEndpoint is the OTLP/HTTP collector spans are exported to,
+	// tracing is off when it's empty
+	OTLPEndpoint string
+	// ServiceName is the service.name spans are reported under
+	ServiceName string
+	// MaxConcurrentWebhooks caps how many webhooks are processed at once,
+	// 16 per GOMAXPROCS by default
+	MaxConcurrentWebhooks int
+	// MaxRequestsPerConn closes a keep-alive connection once it has served
+	// this many requests, 0 leaves connections open
+	MaxRequestsPerConn int
+	// RedactPaths are the dot separated payload paths masked when payloads
+	// are logged at debug level
+	RedactPaths []string
+	// RecentEventsSize is how many webhooks /debug/recent remembers
+	RecentEventsSize int
+	// DebugCapture is a directory every webhook request and our response
+	// to it are written to, redacted, for debugging a provider
+	// integration. capturing is off when it's empty
+	DebugCapture string
+	// DebugCaptureMaxFiles is how many capture files are kept, the oldest
+	// are removed first
+	DebugCaptureMaxFiles int
+	// AdminUser and AdminPass guard the admin routes (/events, /debug,
+	// /deadletter) with basic auth, those routes are closed when unset
+	AdminUser string
+	AdminPass string
+	// ForwardURL is where processed payments are relayed, forwarding is
+	// off when it's empty
+	ForwardURL string
+	// ForwardRetries is how many times a failed forward is retried before
+	// it is dead lettered
+	ForwardRetries int
+	// ForwardBatchSize turns on batching, events are sent downstream as a
+	// JSON array once this many are waiting. 0 sends them one by one
+	ForwardBatchSize int
+	// ForwardBatchInterval is the longest an event waits for its batch
+	ForwardBatchInterval time.Duration
+	// ForwardWorkers is how many forwards are delivered concurrently
+	ForwardWorkers int
+	// ForwardQueueSize is how many forwards may wait for a worker before
+	// new webhooks are failed back to the sender. with batching it's how
+	// many events may wait to be sent, more than that are dead lettered
+	ForwardQueueSize int
+	// DeadLetterSize is how many dead letters /deadletter keeps, 1000 by
+	// default. the oldest are dropped first and counted in
+	// forward_dead_letters_dropped_total
+	DeadLetterSize int
+	// ForwardTimeout bounds a single forward attempt
+	ForwardTimeout time.Duration
+	// ForwardBreakerThreshold is how many forwards in a row may fail before
+	// the downstream is left alone for ForwardBreakerCooldown, 0 keeps
+	// trying every time. a queued forward turned away by the open breaker
+	// doesn't use up one of its ForwardRetries, so during an outage that
+	// outlasts every cooldown it waits for the downstream rather than
+	// being dead lettered. its worker waits with it, once every worker is
+	// waiting new forwards fill the queue and then go to the dead letters
+	ForwardBreakerThreshold int
+	ForwardBreakerCooldown  time.Duration
+	// ForwardFailurePolicy is what the sender hears when forwarding fails,
+	// "ack-always" (the default) answers 200 and leaves the retries to the
+	// forward queue, "ack-on-success" forwards before answering and sends
+	// a 502 on failure so the sender retries
+	ForwardFailurePolicy string
+}
+
+// LoadConfig reads the config from the environment, falling back to sensible
+// defaults, and reports every invalid or missing value at once
+func LoadConfig() (Config, error) {
+	cfg, err := loadEnv()
+	return cfg, errors.Join(err, cfg.Validate())
+}
+
+// loadEnv reads every setting from the environment, it only reports values
+// that can't be parsed and leaves the rest to Validate
+func loadEnv() (Config, error) {
+	var errs []error
+	d := defaultConfig()
+
+	cfg := Config{
+		Addr:                 resolveListenAddr(d.Addr),
+		InternalAddr:         os.Getenv("INTERNAL_ADDR"),
+		StripeSecret:         os.Getenv("STRIPE_SECRET"),
+		LegacySecret:         os.Getenv("LEGACY_SECRET"),
+		LogFormat:            envOr("LOG_FORMAT", d.LogFormat),
+		LogLevel:             parseLogLevel(os.Getenv("LOG_LEVEL")),
+		LogOutput:            envOr("LOG_OUTPUT", d.LogOutput),
+		ForwardURL:           os.Getenv("FORWARD_URL"),
+		ForwardFailurePolicy: envOr("FORWARD_FAILURE_POLICY", d.ForwardFailurePolicy),
+		TLSCertFile:          os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:           os.Getenv("TLS_KEY_FILE"),
+		HealthStatus:         envOr("HEALTH_STATUS", d.HealthStatus),
+		AdminUser:            os.Getenv("ADMIN_USER"),
+		AdminPass:            os.Getenv("ADMIN_PASS"),
+		OTLPEndpoint:         os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName:          envOr("OTEL_SERVICE_NAME", d.ServiceName),
+		DatabaseURL:          os.Getenv("DATABASE_URL"),
+		DatabaseDriver:       envOr("DATABASE_DRIVER", d.DatabaseDriver),
+		AllowedCurrencies:    parseCurrencyAllowList(os.Getenv("ALLOWED_CURRENCIES")),
+		RoutePrefix:          normalizeRoutePrefix(os.Getenv("ROUTE_PREFIX")),
+		DebugCapture:         os.Getenv("DEBUG_CAPTURE"),
+		RedactPaths:          d.RedactPaths,
+	}
+
+	var err error
+	if cfg.PaystackSecret, err = loadSecret("PAYSTACK_SECRET_FILE", paystackSecretProvider()); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, secret := range strings.Split(os.Getenv("PAYSTACK_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			cfg.PaystackSecrets = append(cfg.PaystackSecrets, secret)
+		}
+	}
+
+	if paths := os.Getenv("REDACT_PATHS"); paths != "" {
+		cfg.RedactPaths = strings.Split(paths, ",")
+	}
+
+	if cfg.ShutdownTimeout, err = envDuration("SHUTDOWN_TIMEOUT", d.ShutdownTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.ReadHeaderTimeout, err = envDuration("READ_HEADER_TIMEOUT", d.ReadHeaderTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.ReadTimeout, err = envDuration("READ_TIMEOUT", d.ReadTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.WriteTimeout, err = envDuration("WRITE_TIMEOUT", d.WriteTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.IdleTimeout, err = envDuration("IDLE_TIMEOUT", d.IdleTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.RequestTimeout, err = envDuration("REQUEST_TIMEOUT", d.RequestTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.MaxEventAge, err = envDuration("MAX_EVENT_AGE", d.MaxEventAge); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.IdempotencyTTL, err = envDuration("IDEMPOTENCY_TTL", d.IdempotencyTTL); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.MaxBodyBytes, err = envPositiveInt("MAX_BODY_BYTES", d.MaxBodyBytes); err != nil {
+		errs = append(errs, err)
+	}
+
+	headerBytes, err := envPositiveInt("MAX_HEADER_BYTES", int64(d.MaxHeaderBytes))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.MaxHeaderBytes = int(headerBytes)
+
+	headerCount, err := envPositiveInt("MAX_HEADER_COUNT", int64(d.MaxHeaderCount))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.MaxHeaderCount = int(headerCount)
+
+	if cfg.LogMaxSize, err = envNonNegativeInt("LOG_MAX_SIZE", d.LogMaxSize); err != nil {
+		errs = append(errs, err)
+	}
+
+	logBackups, err := envNonNegativeInt("LOG_MAX_BACKUPS", int64(d.LogMaxBackups))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.LogMaxBackups = int(logBackups)
+
+	if cfg.ForwardTimeout, err = envDuration("FORWARD_TIMEOUT", d.ForwardTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.AllowedCIDRs, err = parseCIDRs(os.Getenv("ALLOWED_CIDRS")); err != nil {
+		errs = append(errs, fmt.Errorf("invalid ALLOWED_CIDRS: %w", err))
+	}
+
+	if cfg.TrustProxy, err = parseCIDRs(os.Getenv("TRUST_PROXY")); err != nil {
+		errs = append(errs, fmt.Errorf("invalid TRUST_PROXY: %w", err))
+	}
+
+	if cfg.TrustForwardedFor, err = envBool("TRUST_FORWARDED_FOR", false); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.PrettyJSON, err = envBool("PRETTY_JSON", false); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.StrictDecode, err = envBool("STRICT_DECODE", false); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.RateLimit, err = envNonNegativeFloat("RATE_LIMIT", d.RateLimit); err != nil {
+		errs = append(errs, err)
+	}
+
+	burst, err := envPositiveInt("RATE_BURST", int64(d.RateBurst))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.RateBurst = int(burst)
+
+	concurrent, err := envPositiveInt("MAX_CONCURRENT_WEBHOOKS", int64(d.MaxConcurrentWebhooks))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.MaxConcurrentWebhooks = int(concurrent)
+
+	perConn, err := envNonNegativeInt("MAX_REQUESTS_PER_CONN", int64(d.MaxRequestsPerConn))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.MaxRequestsPerConn = int(perConn)
+
+	memoryStoreSize, err := envPositiveInt("MEMORY_STORE_SIZE", int64(d.MemoryStoreSize))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.MemoryStoreSize = int(memoryStoreSize)
+
+	recentSize, err := envPositiveInt("RECENT_EVENTS_SIZE", int64(d.RecentEventsSize))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.RecentEventsSize = int(recentSize)
+
+	captureFiles, err := envPositiveInt("DEBUG_CAPTURE_MAX_FILES", int64(d.DebugCaptureMaxFiles))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.DebugCaptureMaxFiles = int(captureFiles)
+
+	retries, err := envNonNegativeInt("FORWARD_RETRIES", int64(d.ForwardRetries))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.ForwardRetries = int(retries)
+
+	batchSize, err := envNonNegativeInt("FORWARD_BATCH_SIZE", int64(d.ForwardBatchSize))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.ForwardBatchSize = int(batchSize)
+
+	if cfg.ForwardBatchInterval, err = envDuration("FORWARD_BATCH_INTERVAL", d.ForwardBatchInterval); err != nil {
+		errs = append(errs, err)
+	}
+
+	breakerThreshold, err := envNonNegativeInt("FORWARD_BREAKER_THRESHOLD", int64(d.ForwardBreakerThreshold))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.ForwardBreakerThreshold = int(breakerThreshold)
+
+	if cfg.ForwardBreakerCooldown, err = envDuration("FORWARD_BREAKER_COOLDOWN", d.ForwardBreakerCooldown); err != nil {
+		errs = append(errs, err)
+	}
+
+	workers, err := envPositiveInt("FORWARD_WORKERS", int64(d.ForwardWorkers))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.ForwardWorkers = int(workers)
+
+	queueSize, err := envPositiveInt("FORWARD_QUEUE_SIZE", int64(d.ForwardQueueSize))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.ForwardQueueSize = int(queueSize)
+
+	deadLetterSize, err := envPositiveInt("DEAD_LETTER_SIZE", int64(d.DeadLetterSize))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.DeadLetterSize = int(deadLetterSize)
+
+	return cfg, errors.Join(errs...)
+}
+
+// Validate checks the settings that are required or only make sense
+// together, it runs after every source (env, flags) has been applied
+func (cfg Config) Validate() error {
+	var errs []error
+
+	if len(cfg.paystackKeys()) == 0 {
+		errs = append(errs, errors.New("PAYSTACK_SECRET, PAYSTACK_SECRET_FILE or PAYSTACK_SECRETS is required to verify webhook signatures"))
+	}
+
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be text or json, got %q", cfg.LogFormat))
+	}
+
+	if cfg.ForwardURL != "" {
+		if u, err := url.Parse(cfg.ForwardURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("FORWARD_URL must be an absolute URL, got %q", cfg.ForwardURL))
+		}
+	}
+
+	if cfg.ForwardFailurePolicy != ackAlways && cfg.ForwardFailurePolicy != ackOnSuccess {
+		errs = append(errs, fmt.Errorf("FORWARD_FAILURE_POLICY must be %s or %s, got %q", ackAlways, ackOnSuccess, cfg.ForwardFailurePolicy))
+	}
+
+	// a batch goes out after the sender got its answer
+	if cfg.ForwardFailurePolicy == ackOnSuccess && cfg.ForwardBatchSize > 0 {
+		errs = append(errs, fmt.Errorf("FORWARD_BATCH_SIZE can't be used with FORWARD_FAILURE_POLICY=%s", ackOnSuccess))
+	}
+
+	if cfg.ForwardBatchSize > 0 && cfg.ForwardBatchInterval <= 0 {
+		errs = append(errs, fmt.Errorf("FORWARD_BATCH_INTERVAL must be positive when batching, got %s", cfg.ForwardBatchInterval))
+	}
+
+	// a batch can't fill up while the backlog turns events away
+	if cfg.ForwardBatchSize > cfg.ForwardQueueSize {
+		errs = append(errs, fmt.Errorf("FORWARD_QUEUE_SIZE must be at least FORWARD_BATCH_SIZE (%d) when batching, got %d", cfg.ForwardBatchSize, cfg.ForwardQueueSize))
+	}
+
+	if cfg.InternalAddr != "" && cfg.InternalAddr == cfg.Addr {
+		errs = append(errs, fmt.Errorf("INTERNAL_ADDR must differ from the listen address, both are %q", cfg.Addr))
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+
+	if (cfg.AdminUser == "") != (cfg.AdminPass == "") {
+		errs = append(errs, errors.New("ADMIN_USER and ADMIN_PASS must be set together"))
+	}
+
+	if cfg.OTLPEndpoint != "" {
+		if u, err := url.Parse(cfg.OTLPEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("OTEL_EXPORTER_OTLP_ENDPOINT must be an absolute URL, got %q", cfg.OTLPEndpoint))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// paystackKeys is every key a paystack delivery may be signed with, the
+// primary secret first
+func (cfg Config) paystackKeys() []string {
+	var keys []string
+	for _, key := range append([]string{cfg.PaystackSecret}, cfg.PaystackSecrets...) {
+		if key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// resolveListenAddr picks the address to listen on, ADDR wins over PORT
+// and we fall back to fallback when neither is set
+func resolveListenAddr(fallback string) string {
+	if addr := os.Getenv("ADDR"); addr != "" {
+		return addr
+	}
+
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+
+	return fallback
+}
+
+// normalizeRoutePrefix turns "webhooks/" or "/webhooks" into "/webhooks",
+// and "/" or "" into no prefix at all
+func normalizeRoutePrefix(prefix string) string {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return ""
+	}
+
+	return "/" + prefix
+}
+
+// defaultConfig is what every setting falls back to when its variable
+// isn't set
+func defaultConfig() Config {
+	return Config{
+		Addr:                    ":3000",
+		LogFormat:               "text",
+		LogOutput:               "stdout",
+		HealthStatus:            "ok",
+		ServiceName:             "dynamic-api-handling",
+		DatabaseDriver:          "sqlite",
+		RedactPaths:             defaultRedactPaths,
+		ShutdownTimeout:         10 * time.Second,
+		ReadHeaderTimeout:       5 * time.Second,
+		ReadTimeout:             15 * time.Second,
+		WriteTimeout:            30 * time.Second,
+		IdleTimeout:             60 * time.Second,
+		RequestTimeout:          10 * time.Second,
+		IdempotencyTTL:          24 * time.Hour,
+		MaxBodyBytes:            1 << 20,
+		MaxHeaderBytes:          64 << 10,
+		MaxHeaderCount:          100,
+		LogMaxBackups:           5,
+		RateBurst:               20,
+		MaxConcurrentWebhooks:   16 * runtime.GOMAXPROCS(0),
+		MemoryStoreSize:         10000,
+		RecentEventsSize:        100,
+		DebugCaptureMaxFiles:    100,
+		ForwardRetries:          3,
+		ForwardBatchInterval:    5 * time.Second,
+		ForwardWorkers:          4,
+		ForwardQueueSize:        1000,
+		DeadLetterSize:          1000,
+		ForwardTimeout:          5 * time.Second,
+		ForwardBreakerThreshold: 5,
+		ForwardBreakerCooldown:  30 * time.Second,
+		ForwardFailurePolicy:    ackAlways,
+	}
+}
+
+// withDefaults fills the settings left at their zero value from
+// defaultConfig, for configs built in code rather than by LoadConfig.
+// settings where zero means something (off, none, no retries) are kept
+func (cfg Config) withDefaults() Config {
+	d := defaultConfig()
+
+	orDefault(&cfg.Addr, d.Addr)
+	orDefault(&cfg.LogFormat, d.LogFormat)
+	orDefault(&cfg.LogOutput, d.LogOutput)
+	orDefault(&cfg.HealthStatus, d.HealthStatus)
+	orDefault(&cfg.ServiceName, d.ServiceName)
+	orDefault(&cfg.DatabaseDriver, d.DatabaseDriver)
+	orDefault(&cfg.ShutdownTimeout, d.ShutdownTimeout)
+	orDefault(&cfg.ReadHeaderTimeout, d.ReadHeaderTimeout)
+	orDefault(&cfg.ReadTimeout, d.ReadTimeout)
+	orDefault(&cfg.WriteTimeout, d.WriteTimeout)
+	orDefault(&cfg.IdleTimeout, d.IdleTimeout)
+	orDefault(&cfg.IdempotencyTTL, d.IdempotencyTTL)
+	orDefault(&cfg.MaxBodyBytes, d.MaxBodyBytes)
+	orDefault(&cfg.MaxHeaderBytes, d.MaxHeaderBytes)
+	orDefault(&cfg.MaxHeaderCount, d.MaxHeaderCount)
+	orDefault(&cfg.RateBurst, d.RateBurst)
+	orDefault(&cfg.MaxConcurrentWebhooks, d.MaxConcurrentWebhooks)
+	orDefault(&cfg.MemoryStoreSize, d.MemoryStoreSize)
+	orDefault(&cfg.RecentEventsSize, d.RecentEventsSize)
+	orDefault(&cfg.DebugCaptureMaxFiles, d.DebugCaptureMaxFiles)
+	orDefault(&cfg.ForwardBatchInterval, d.ForwardBatchInterval)
+	orDefault(&cfg.ForwardWorkers, d.ForwardWorkers)
+	orDefault(&cfg.ForwardQueueSize, d.ForwardQueueSize)
+	orDefault(&cfg.DeadLetterSize, d.DeadLetterSize)
+	orDefault(&cfg.ForwardTimeout, d.ForwardTimeout)
+	orDefault(&cfg.ForwardBreakerCooldown, d.ForwardBreakerCooldown)
+	orDefault(&cfg.ForwardFailurePolicy, d.ForwardFailurePolicy)
+
+	if cfg.RedactPaths == nil {
+		cfg.RedactPaths = d.RedactPaths
+	}
+
+	return cfg
+}
+
+func orDefault[T comparable](v *T, fallback T) {
+	var zero T
+	if *v == zero {
+		*v = fallback
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return d, nil
+}
+
+func envBool(key string, fallback bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return b, nil
+}
+
+func envNonNegativeFloat(key string, fallback float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	if f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid %s: must be a non-negative number, got %s", key, v)
+	}
+
+	return f, nil
+}
+
+func envPositiveInt(key string, fallback int64) (int64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid %s: must be positive, got %d", key, n)
+	}
+
+	return n, nil
+}
+
+func envNonNegativeInt(key string, fallback int64) (int64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	if n < 0 {
+		return 0, fmt.Errorf("invalid %s: must not be negative, got %d", key, n)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownEvent is returned by DecodeEvent for event names it has no type for
+var ErrUnknownEvent = errors.New("unknown event")
+
+// Event is implemented by every typed webhook payload, callers get one from
+// DecodeEvent and type switch on it to reach the concrete struct
+type Event interface {
+	EventName() string
+	Validate() error
+	Normalize() NormalizedEvent
+}
+
+func (p paymentPending) EventName() string    { return p.Event }
+func (p paymentSuccessful) EventName() string { return p.Event }
+func (p paymentExpired) EventName() string    { return p.Event }
+func (c chargeSuccess) EventName() string     { return c.Event }
+
+// eventDecoders maps an event name to the function that parses its payload
+var eventDecoders = map[string]func(json.RawMessage) (Event, error){
+	"paymentrequest.pending": decodeAs[paymentPending],
+	"paymentrequest.success": decodeAs[paymentSuccessful],
+	"paymentrequest.expired": decodeAs[paymentExpired],
+	"charge.success":         decodeAs[chargeSuccess],
+	"invoice.create":         decodeAs[invoiceEvent],
+	"invoice.update":         decodeAs[invoiceEvent],
+}
+
+// DecodeEvent parses raw into the typed event its event field names. it
+// doesn't know anything about HTTP so it can be used wherever a raw payload
+// turns up
+func DecodeEvent(raw json.RawMessage) (Event, error) {
+	var eventIdentfier eventIdentfier
+	if err := json.Unmarshal(raw, &eventIdentfier); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	decode, ok := eventDecoders[eventIdentfier.Event]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEvent, eventIdentfier.Event)
+	}
+
+	return decode(raw)
+}
+
+func decodeAs[T Event](raw json.RawMessage) (Event, error) {
+	var ev T
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	return ev, nil
+}
+
+// unmarshalEvent decodes the raw payload of event into v. in strict mode a
+// field v has no room for is reported as a validation error, so we find out
+// when a provider starts sending something we don't handle yet
+func unmarshalEvent(raw json.RawMessage, event string, v any, strict bool) error {
+	if !strict {
+		if err := json.Unmarshal(raw, v); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		// encoding/json has no typed error for this one
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			if name, err := strconv.Unquote(field); err == nil {
+				field = name
+			}
+			return &ValidationError{Event: event, Fields: []FieldError{{Field: field, Message: "unknown field"}}}
+		}
+
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	// json.Unmarshal rejects anything after the value, the decoder doesn't
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("%w: unexpected data after the payload", ErrInvalidPayload)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// Subscriber receives every event that was parsed and handled successfully
+type Subscriber func(ctx context.Context, ev NormalizedEvent) error
+
+type subscription struct {
+	name     string
+	priority int
+	fn       Subscriber
+}
+
+// Dispatcher fans handled events out to the internal systems subscribed to
+// them. subscribers run in priority bands, lowest first, and concurrently
+// within a band. one failing doesn't stop the others, later bands included
+type Dispatcher struct {
+	mu   sync.RWMutex
+	subs []subscription
+	l    *slog.Logger
+}
+
+func NewDispatcher(l *slog.Logger) *Dispatcher {
+	return &Dispatcher{l: l}
+}
+
+// Subscribe adds fn under name with priority 0, the name only shows up in
+// logs and errors
+func (d *Dispatcher) Subscribe(name string, fn func(ctx context.Context, ev NormalizedEvent) error) {
+	d.SubscribeWithPriority(name, 0, fn)
+}
+
+// SubscribeWithPriority adds fn under name, it only gets an event once every
+// subscriber with a lower priority is done with it
+func (d *Dispatcher) SubscribeWithPriority(name string, priority int, fn func(ctx context.Context, ev NormalizedEvent) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// a fresh slice so a Dispatch still ranging over the old one isn't
+	// disturbed, stable so a band keeps subscription order
+	subs := append(append([]subscription(nil), d.subs...), subscription{name: name, priority: priority, fn: fn})
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].priority < subs[j].priority })
+	d.subs = subs
+}
+
+// Dispatch hands ev to every subscriber, band by band, and waits for all of
+// them. the failures are logged one by one and returned joined together
+func (d *Dispatcher) Dispatch(ctx context.Context, ev NormalizedEvent) error {
+	d.mu.RLock()
+	subs := d.subs
+	d.mu.RUnlock()
+
+	errs := make([]error, len(subs))
+
+	// subs is sorted, so each band is a run of equal priorities
+	for start := 0; start < len(subs); {
+		end := start + 1
+		for end < len(subs) && subs[end].priority == subs[start].priority {
+			end++
+		}
+
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int, sub subscription) {
+				defer wg.Done()
+
+				if err := d.deliver(ctx, sub, ev); err != nil {
+					d.l.Error("subscriber failed to handle event", "subscriber", sub.name, "priority", sub.priority, "event", ev.Type, "error context", err)
+					errs[i] = fmt.Errorf("subscriber %s: %w", sub.name, err)
+				}
+			}(i, subs[i])
+		}
+		wg.Wait()
+
+		start = end
+	}
+
+	return errors.Join(errs...)
+}
+
+// deliver runs a single subscriber, a panic is turned into an error since
+// Recover only covers the request goroutine
+func (d *Dispatcher) deliver(ctx context.Context, sub subscription, ev NormalizedEvent) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return sub.fn(ctx, ev)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// a dry run parses and validates a webhook like any other delivery but skips
+// everything with a side effect (persistence, idempotency marks, forwarding)
+
+const dryRunHeader = "X-Dry-Run"
+
+type dryRunKey struct{}
+
+// dryRunRequested reports whether the caller asked for a dry run with
+// ?dryRun=true or the X-Dry-Run header
+func dryRunRequested(r *http.Request) bool {
+	for _, v := range []string{r.URL.Query().Get("dryRun"), r.Header.Get(dryRunHeader)} {
+		if ok, err := strconv.ParseBool(v); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func withDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// isDryRun tells event handlers to skip their side effects
+func isDryRun(ctx context.Context) bool {
+	ok, _ := ctx.Value(dryRunKey{}).(bool)
+	return ok
+}
+
+// dryRunReport describes what would have happened to a delivery
+type dryRunReport struct {
+	DryRun  bool   `json:"dry_run"`
+	Event   string `json:"event"`
+	Outcome string `json:"outcome"`
+	Result  any    `json:"result,omitempty"`
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// this will be used to identify the event type
+//
+// we care about just the event head
+type eventIdentfier struct {
+	Event string `json:"event"`
+}
+
+// PaymentRequestData is the data block shared by the paymentrequest.* events
+type PaymentRequestData struct {
+	ID               int            `json:"id"`
+	Domain           string         `json:"domain"`
+	Amount           Amount         `json:"amount"`
+	Currency         string         `json:"currency"`
+	DueDate          NullTime       `json:"due_date"`
+	HasInvoice       bool           `json:"has_invoice"`
+	InvoiceNumber    NullString     `json:"invoice_number"`
+	Description      string         `json:"description"`
+	PdfURL           any            `json:"pdf_url"`
+	LineItems        []LineItem     `json:"line_items"`
+	Tax              []TaxEntry     `json:"tax"`
+	RequestCode      string         `json:"request_code"`
+	Status           PaymentStatus  `json:"status"`
+	Paid             bool           `json:"paid"`
+	PaidAt           NullTime       `json:"paid_at"`
+	Metadata         Metadata       `json:"metadata"`
+	Notifications    []Notification `json:"notifications"`
+	OfflineReference string         `json:"offline_reference"`
+	Customer         Customer       `json:"customer"`
+	CreatedAt        time.Time      `json:"created_at"`
+}
+
+// LineItem is one billed item on a payment request, Amount is in the
+// currency's minor unit
+type LineItem struct {
+	Name     string `json:"name"`
+	Amount   Amount `json:"amount"`
+	Quantity int    `json:"quantity,omitempty"`
+}
+
+// TaxEntry is one tax applied to a payment request, Amount is in the
+// currency's minor unit
+type TaxEntry struct {
+	Name   string `json:"name"`
+	Amount Amount `json:"amount"`
+}
+
+// Notification records when and how the customer was notified about a
+// payment request
+type Notification struct {
+	SentAt  time.Time `json:"sent_at"`
+	Channel string    `json:"channel"`
+}
+
+type paymentPending struct {
+	Event string             `json:"event"`
+	Data  PaymentRequestData `json:"data"`
+}
+
+type paymentSuccessful struct {
+	Event string             `json:"event"`
+	Data  PaymentRequestData `json:"data"`
+}
+
+// paymentExpired is sent when a payment request lapses without being paid
+type paymentExpired struct {
+	Event string             `json:"event"`
+	Data  PaymentRequestData `json:"data"`
+}
+
+// paymentRequestStatuses are the statuses Paystack sends for payment requests
+var paymentRequestStatuses = []PaymentStatus{StatusPending, StatusSuccess, StatusFailed, StatusExpired}
+
+// validate checks the fields every payment request event relies on
+func (d PaymentRequestData) validate(v *validator) {
+	v.check(d.Amount > 0, "data.amount", "must be greater than zero")
+	v.check(d.Currency != "", "data.currency", "is required")
+	v.status(d.Status, "data.status", paymentRequestStatuses...)
+}
+
+func (p paymentPending) Validate() error {
+	var v validator
+	p.Data.validate(&v)
+
+	return v.err(p.Event)
+}
+
+func (p paymentSuccessful) Validate() error {
+	var v validator
+	p.Data.validate(&v)
+
+	return v.err(p.Event)
+}
+
+func (p paymentExpired) Validate() error {
+	var v validator
+	p.Data.validate(&v)
+
+	return v.err(p.Event)
+}
+
+type chargeSuccess struct {
+	Event string `json:"event"`
+	Data  struct {
+		ID              int           `json:"id"`
+		Domain          string        `json:"domain"`
+		Status          PaymentStatus `json:"status"`
+		Reference       string        `json:"reference"`
+		Amount          Amount        `json:"amount"`
+		Message         any           `json:"message"`
+		GatewayResponse string        `json:"gateway_response"`
+		PaidAt          time.Time     `json:"paid_at"`
+		CreatedAt       time.Time     `json:"created_at"`
+		Channel         string        `json:"channel"`
+		Currency        string        `json:"currency"`
+		IPAddress       string        `json:"ip_address"`
+		Metadata        Metadata      `json:"metadata"`
+		Fees            any           `json:"fees"`
+		Customer        struct {
+			ID           int    `json:"id"`
+			FirstName    string `json:"first_name"`
+			LastName     string `json:"last_name"`
+			Email        string `json:"email"`
+			CustomerCode string `json:"customer_code"`
+			Phone        any    `json:"phone"`
+			Metadata     any    `json:"metadata"`
+			RiskAction   string `json:"risk_action"`
+		} `json:"customer"`
+		Authorization Authorization `json:"authorization"`
+	} `json:"data"`
+}
+
+// Authorization is the reusable card or account a charge was made with
+type Authorization struct {
+	AuthorizationCode string `json:"authorization_code"`
+	Bin               string `json:"bin"`
+	Last4             string `json:"last4"`
+	ExpMonth          string `json:"exp_month"`
+	ExpYear           string `json:"exp_year"`
+	Channel           string `json:"channel"`
+	CardType          string `json:"card_type"`
+	Bank              string `json:"bank"`
+	CountryCode       string `json:"country_code"`
+	Brand             string `json:"brand"`
+	Reusable          bool   `json:"reusable"`
+	Signature         string `json:"signature"`
+	AccountName       any    `json:"account_name"`
+}
+
+func (c chargeSuccess) Validate() error {
+	var v validator
+	v.check(c.Data.Amount > 0, "data.amount", "must be greater than zero")
+	v.check(c.Data.Currency != "", "data.currency", "is required")
+	v.check(c.Data.Reference != "", "data.reference", "is required")
+	v.status(c.Data.Status, "data.status", StatusSuccess)
+
+	return v.err(c.Event)
+}
+
+func HandlePaymentPending(l *slog.Logger, currencies CurrencyAllowList, strict bool) EventHandler {
+	return func(ctx context.Context, raw json.RawMessage) (HandlerResult, error) {
+		var paymentPending paymentPending
+
+		l.Info("payment pending hook event", "response event title", "paymentrequest.pending")
+
+		if err := unmarshalEvent(raw, "paymentrequest.pending", &paymentPending, strict); err != nil {
+			l.Error("error marshalling pending payment data", "error context", err)
+			return HandlerResult{}, err
+		}
+
+		if err := paymentPending.Validate(); err != nil {
+			return HandlerResult{}, err
+		}
+
+		if err := currencies.check(paymentPending.Event, paymentPending.Data.Currency); err != nil {
+			return HandlerResult{}, err
+		}
+
+		l.Info("pending response data unmarshalled successfully", "pending ID", paymentPending.Data.ID, "pending amount", paymentPending.Data.Money())
+
+		return handled(paymentPending.Normalize()), nil
+	}
+}
+
+// HandlePaymentSuccessful handles paymentrequest.success and relays the
+// payment through fwd when one is configured
+func HandlePaymentSuccessful(l *slog.Logger, fwd Forwarder, currencies CurrencyAllowList, strict bool) EventHandler {
+	return func(ctx context.Context, raw json.RawMessage) (HandlerResult, error) {
+		var paymentSuccessful paymentSuccessful
+
+		l.Info("payment successful hook event", "response event title", "paymentrequest.success")
+
+		if err := unmarshalEvent(raw, "paymentrequest.success", &paymentSuccessful, strict); err != nil {
+			l.Error("error marshalling successful payment data", "error context", err)
+			return HandlerResult{}, err
+		}
+
+		if err := paymentSuccessful.Validate(); err != nil {
+			return HandlerResult{}, err
+		}
+
+		if err := currencies.check(paymentSuccessful.Event, paymentSuccessful.Data.Currency); err != nil {
+			return HandlerResult{}, err
+		}
+
+		l.Info("success response data unmarshalled successfully", "success ID", paymentSuccessful.Data.ID, "success amount", paymentSuccessful.Data.Money())
+
+		normalized := paymentSuccessful.Normalize()
+
+		if fwd != nil && !isDryRun(ctx) {
+			if err := fwd.Forward(ctx, paymentSuccessful.Event, normalized); err != nil {
+				return HandlerResult{}, &ForwardError{Event: paymentSuccessful.Event, Result: handled(normalized), Err: err}
+			}
+		}
+
+		return handled(normalized), nil
+	}
+}
+
+// HandlePaymentExpired handles paymentrequest.expired, an expired request
+// means money we were expecting isn't coming so it's logged as a warning
+func HandlePaymentExpired(l *slog.Logger, currencies CurrencyAllowList, strict bool) EventHandler {
+	return func(ctx context.Context, raw json.RawMessage) (HandlerResult, error) {
+		var paymentExpired paymentExpired
+
+		if err := unmarshalEvent(raw, "paymentrequest.expired", &paymentExpired, strict); err != nil {
+			l.Error("error marshalling expired payment data", "error context", err)
+			return HandlerResult{}, err
+		}
+
+		if err := paymentExpired.Validate(); err != nil {
+			return HandlerResult{}, err
+		}
+
+		if err := currencies.check(paymentExpired.Event, paymentExpired.Data.Currency); err != nil {
+			return HandlerResult{}, err
+		}
+
+		l.Warn("payment request expired unpaid", "request code", paymentExpired.Data.RequestCode, "status", paymentExpired.Data.Status, "expired amount", paymentExpired.Data.Money())
+
+		return handled(paymentExpired.Normalize()), nil
+	}
+}
+
+// HandleChargeSuccess handles charge.success and relays the charge through
+// fwd when one is configured
+func HandleChargeSuccess(l *slog.Logger, fwd Forwarder, currencies CurrencyAllowList, strict bool) EventHandler {
+	return func(ctx context.Context, raw json.RawMessage) (HandlerResult, error) {
+		var chargeSuccess chargeSuccess
+
+		l.Info("charge successful hook event", "response event title", "charge.success")
+
+		if err := unmarshalEvent(raw, "charge.success", &chargeSuccess, strict); err != nil {
+			l.Error("error marshalling successful charge data", "error context", err)
+			return HandlerResult{}, err
+		}
+
+		if err := chargeSuccess.Validate(); err != nil {
+			return HandlerResult{}, err
+		}
+
+		if err := currencies.check(chargeSuccess.Event, chargeSuccess.Data.Currency); err != nil {
+			return HandlerResult{}, err
+		}
+
+		l.Info("charge response data unmarshalled successfully", "charge reference", chargeSuccess.Data.Reference, "charge amount", chargeSuccess.Money())
+
+		normalized := chargeSuccess.Normalize()
+
+		if fwd != nil && !isDryRun(ctx) {
+			if err := fwd.Forward(ctx, chargeSuccess.Event, normalized); err != nil {
+				return HandlerResult{}, &ForwardError{Event: chargeSuccess.Event, Result: handled(normalized), Err: err}
+			}
+		}
+
+		return handled(normalized), nil
+	}
+}
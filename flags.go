@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"flag"
+)
+
+// LoadConfigWithFlags is LoadConfig with command line flags layered on top,
+// a flag that is passed wins over the matching env var
+func LoadConfigWithFlags(args []string) (Config, error) {
+	cfg, envErr := loadEnv()
+
+	cfg, flagErr := ParseFlags(cfg, args)
+	if errors.Is(flagErr, flag.ErrHelp) {
+		return cfg, flagErr
+	}
+
+	return cfg, errors.Join(envErr, flagErr, cfg.Validate())
+}
+
+// ParseFlags overrides cfg with whatever flags are set in args, the values
+// already in cfg are used as the flag defaults
+func ParseFlags(cfg Config, args []string) (Config, error) {
+	fs := flag.NewFlagSet("handling-dynamic-api", flag.ContinueOnError)
+
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "address to listen on (env ADDR or PORT)")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log format, text or json (env LOG_FORMAT)")
+	logLevel := fs.String("log-level", cfg.LogLevel.String(), "minimum log level (env LOG_LEVEL)")
+	// no default here, -h would print the secret from the env otherwise
+	secret := fs.String("secret", "", "paystack secret key used to verify webhooks (env PAYSTACK_SECRET)")
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	cfg.LogLevel = parseLogLevel(*logLevel)
+	if *secret != "" {
+		cfg.PaystackSecret = *secret
+	}
+
+	return cfg, nil
+}
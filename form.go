@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// formMediaType is what the legacy provider posts its webhooks as
+const formMediaType = "application/x-www-form-urlencoded"
+
+// the legacy provider signs the form body as sent with a HMAC-SHA256 and
+// puts the hex digest in this header
+const formSignatureHeader = "X-Signature"
+
+// FormProvider handles a legacy provider that posts form encoded webhooks,
+// the JSON payload sits in the payload field and names its event the same
+// way paystack does
+type FormProvider struct {
+	EventNamePath
+	secret string
+}
+
+func NewFormProvider(secret string) *FormProvider {
+	return &FormProvider{EventNamePath: defaultEventNamePath, secret: secret}
+}
+
+func (p *FormProvider) Verify(r *http.Request, body []byte) error {
+	got, err := hex.DecodeString(r.Header.Get(formSignatureHeader))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write(body)
+
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// DecodePayload pulls the JSON out of the payload field of the form
+func (p *FormProvider) DecodePayload(body []byte) ([]byte, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	payload := []byte(form.Get("payload"))
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("%w: form has no payload field", ErrInvalidPayload)
+	}
+
+	if !json.Valid(payload) {
+		return nil, fmt.Errorf("%w: payload field isn't JSON", ErrInvalidPayload)
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Forwarder relays a processed event to a downstream service
+type Forwarder interface {
+	Forward(ctx context.Context, event string, payload any) error
+}
+
+// forward failure policies, they decide what the sender hears when an event
+// was handled but couldn't be relayed downstream
+const (
+	// ackAlways acknowledges the delivery anyway, the forward queue owns
+	// the retries
+	ackAlways = "ack-always"
+	// ackOnSuccess answers 502 so the sender retries the whole delivery,
+	// forwards are made while the sender waits
+	ackOnSuccess = "ack-on-success"
+)
+
+// ForwardError is returned by event handlers when the event was handled but
+// relaying it failed, Result is what they would have answered otherwise
+type ForwardError struct {
+	Event  string
+	Result HandlerResult
+	Err    error
+}
+
+func (e *ForwardError) Error() string {
+	return fmt.Sprintf("forwarding %s: %v", e.Event, e.Err)
+}
+
+func (e *ForwardError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPForwarder POSTs events as JSON to a fixed URL, retrying transient
+// failures with exponential backoff
+type HTTPForwarder struct {
+	url     string
+	retries int
+	backoff time.Duration
+	client  *http.Client
+	l       *slog.Logger
+}
+
+// NewHTTPForwarder builds a forwarder for url, every attempt is bounded by
+// timeout and failed attempts are retried up to retries times
+func NewHTTPForwarder(l *slog.Logger, url string, retries int, timeout time.Duration) *HTTPForwarder {
+	return &HTTPForwarder{
+		url:     url,
+		retries: retries,
+		backoff: 200 * time.Millisecond,
+		client:  &http.Client{Timeout: timeout},
+		l:       l,
+	}
+}
+
+// forwardedEvent is the body sent downstream
+type forwardedEvent struct {
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+func (f *HTTPForwarder) Forward(ctx context.Context, event string, payload any) error {
+	body, err := json.Marshal(forwardedEvent{Event: event, Data: payload})
+	if err != nil {
+		return fmt.Errorf("encoding forwarded event: %w", err)
+	}
+
+	return f.send(ctx, event, body)
+}
+
+// send POSTs body with retries, what describes the body in errors and logs
+func (f *HTTPForwarder) send(ctx context.Context, what string, body []byte) error {
+	backoff := f.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := f.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || attempt >= f.retries {
+			return fmt.Errorf("forwarding %s after %d attempt(s): %w", what, attempt+1, err)
+		}
+
+		f.l.Info("forwarding failed, retrying", "event", what, "attempt", attempt+1, "backoff", backoff, "error context", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("forwarding %s: %w", what, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes a single attempt and reports whether a failure is worth retrying
+func (f *HTTPForwarder) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if span := spanFromContext(ctx); span != nil {
+		req.Header.Set(traceparentHeader, span.traceparent())
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// a cancelled context won't get any better by retrying
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("downstream responded with %s", resp.Status)
+	default:
+		return false, fmt.Errorf("downstream responded with %s", resp.Status)
+	}
+}
+
+// Ping checks the downstream is reachable with a HEAD request, any answer
+// short of a 5xx counts as up
+func (f *HTTPForwarder) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, f.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("downstream responded with %s", resp.Status)
+	}
+
+	return nil
+}
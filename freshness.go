@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EventAgeCheck rejects deliveries whose data.created_at is further than
+// MaxAge from now in either direction, which limits how long a captured
+// webhook can be replayed. a zero MaxAge turns the check off
+type EventAgeCheck struct {
+	MaxAge time.Duration
+	// Clock is what the check runs against, tests swap it for a fake one
+	Clock Clock
+}
+
+// ErrEventTooOld and ErrEventInFuture are returned by Check
+var (
+	ErrEventTooOld   = errors.New("event is older than the allowed window")
+	ErrEventInFuture = errors.New("event is dated in the future beyond the allowed window")
+)
+
+// Check looks at data.created_at in raw, events without one are let through
+func (c EventAgeCheck) Check(raw []byte) error {
+	if c.MaxAge <= 0 {
+		return nil
+	}
+
+	var payload struct {
+		Data struct {
+			CreatedAt NullTime `json:"created_at"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	if !payload.Data.CreatedAt.Valid {
+		return nil
+	}
+
+	age := c.Clock.Now().Sub(payload.Data.CreatedAt.Time)
+	switch {
+	case age > c.MaxAge:
+		return fmt.Errorf("%w: created %s ago", ErrEventTooOld, age.Round(time.Second))
+	case age < -c.MaxAge:
+		return fmt.Errorf("%w: created %s from now", ErrEventInFuture, (-age).Round(time.Second))
+	}
+
+	return nil
+}
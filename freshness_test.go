@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventAgeCheck(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC))
+	check := EventAgeCheck{MaxAge: time.Hour, Clock: clock}
+
+	tests := []struct {
+		name string
+		raw  string
+		want error
+	}{
+		{"within the window", `{"data":{"created_at":"2026-01-02T09:30:00Z"}}`, nil},
+		{"on the edge", `{"data":{"created_at":"2026-01-02T09:00:00Z"}}`, nil},
+		{"too old", `{"data":{"created_at":"2026-01-02T08:59:59Z"}}`, ErrEventTooOld},
+		{"in the future", `{"data":{"created_at":"2026-01-02T11:00:01Z"}}`, ErrEventInFuture},
+		{"no created_at", `{"data":{}}`, nil},
+		{"not json", `{"data":`, ErrInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := check.Check([]byte(tt.raw)); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventAgeCheckFollowsTheClock(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC))
+	check := EventAgeCheck{MaxAge: time.Hour, Clock: clock}
+	raw := []byte(`{"data":{"created_at":"2026-01-02T10:00:00Z"}}`)
+
+	if err := check.Check(raw); err != nil {
+		t.Fatalf("fresh event: %v", err)
+	}
+
+	clock.Advance(time.Hour + time.Second)
+	if err := check.Check(raw); !errors.Is(err, ErrEventTooOld) {
+		t.Errorf("an hour later: got %v, want ErrEventTooOld", err)
+	}
+}
+
+func TestEventAgeCheckDisabled(t *testing.T) {
+	check := EventAgeCheck{Clock: newFakeClock(time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC))}
+
+	if err := check.Check([]byte(`{"data":{"created_at":"2001-01-01T00:00:00Z"}}`)); err != nil {
+		t.Errorf("MaxAge 0 rejected an event: %v", err)
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// healthResponse is the /health body, the build info lets ops tell which
+// release is running without shelling into the box
+type healthResponse struct {
+	Status string `json:"status"`
+	Time   string `json:"time"`
+	buildInfo
+}
+
+// HealthCheck says the process is up, status is what goes in the body so
+// checks expecting a particular word can be satisfied. monitors that ask
+// for text/plain get just the status
+func HealthCheck(l *slog.Logger, clock Clock, status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		if prefersPlainText(r.Header.Get("Accept")) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, status+"\n")
+			return
+		}
+
+		now := clock.Now()
+		writeJSON(w, l, http.StatusOK, healthResponse{Status: status, Time: now.UTC().Format(time.RFC3339), buildInfo: currentBuildInfo(now)})
+	}
+}
+
+// Pinger is implemented by dependencies that can report their own health
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ReadyCheck pings every dependency and answers 503 when any of them is
+// unhealthy, unlike HealthCheck which only says the process is up
+func ReadyCheck(l *slog.Logger, deps map[string]Pinger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		status, checks := http.StatusOK, make(map[string]string, len(deps))
+		for name, dep := range deps {
+			if err := dep.Ping(ctx); err != nil {
+				l.Warn("readiness check failed", "dependency", name, "error context", err)
+				status, checks[name] = http.StatusServiceUnavailable, err.Error()
+				continue
+			}
+			checks[name] = "ok"
+		}
+
+		ready := "ready"
+		if status != http.StatusOK {
+			ready = "unavailable"
+		}
+
+		writeJSON(w, l, status, map[string]any{"status": ready, "checks": checks})
+	}
+}
+
+// HandleDynamicAPI serves /dynamic-hook/{provider}, it verifies the delivery
+// with the provider and leaves the rest to the processor
+func HandleDynamicAPI(l *slog.Logger, providers map[string]Provider, processor *WebhookProcessor, metrics *Metrics, redactPaths []string, clock Clock, recent *RecentEvents) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the event label is filled in once we know which event this is
+		started, event := time.Now(), "unknown"
+		rec := newStatusRecorder(w)
+		w = rec
+		defer func() { metrics.observeEvent(event, rec.status, time.Since(started)) }()
+
+		l := l.With("request_id", requestIDFromContext(r.Context()))
+
+		l.Info("This API is connected", "user", os.Getenv("USER"))
+
+		providerName, provider, ok := providerFromPath(providers, r.URL.Path)
+		if !ok {
+			writeError(w, l, APIError{Code: http.StatusNotFound, Message: "unknown provider", Details: map[string]string{"provider": providerName}})
+			return
+		}
+		l = l.With("provider", providerName)
+
+		// read the body once and work off the raw bytes from here on
+		jsonData, err := readBody(r.Body)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				l.Info("request body too large", "limit", maxBytesErr.Limit)
+				writeError(w, l, APIError{Code: http.StatusRequestEntityTooLarge, Message: "request body too large", Details: map[string]int64{"limit": maxBytesErr.Limit}})
+				return
+			}
+
+			l.Error("error reading request body", "error context", err)
+			writeError(w, l, APIError{Code: ackPolicy(ErrInvalidPayload), Message: "error reading request body"})
+			return
+		}
+
+		// an empty body is a sender bug, not something worth an error log
+		if len(bytes.TrimSpace(jsonData)) == 0 {
+			l.Info("rejected webhook with an empty body")
+			writeError(w, l, APIError{Code: ackPolicy(ErrInvalidPayload), Message: "empty body"})
+			return
+		}
+
+		// the signature covers the body as sent, which isn't the JSON payload
+		// for providers that wrap it
+		signedBody := jsonData
+		if decoder, ok := provider.(PayloadDecoder); ok {
+			if jsonData, err = decoder.DecodePayload(signedBody); err != nil {
+				l.Info("rejected webhook with an undecodable body", "error context", err)
+				writeError(w, l, APIError{Code: ackPolicy(err), Message: "invalid payload"})
+				return
+			}
+		}
+
+		// redacting means decoding the whole payload, skip it unless someone
+		// is going to read the line
+		if l.Enabled(r.Context(), slog.LevelDebug) {
+			l.Debug("received webhook payload", "payload", string(redactJSON(jsonData, redactPaths)))
+		}
+
+		_, verifySpan := startSpan(r.Context(), "webhook.verify")
+		verifySpan.SetAttribute("webhook.provider", providerName)
+		err = provider.Verify(r, signedBody)
+		verifySpan.RecordError(err)
+		verifySpan.End()
+
+		if err != nil {
+			l.Info("rejected webhook that failed verification", "remote addr", r.RemoteAddr, "error context", err)
+			// whatever went wrong, the delivery isn't one we can trust
+			writeError(w, l, APIError{Code: ackPolicy(ErrInvalidSignature), Message: "invalid signature"})
+			return
+		}
+
+		ctx := withDelivery(r.Context(), delivery{
+			provider:  providerName,
+			eventName: provider.EventName,
+		})
+
+		dryRun := dryRunRequested(r)
+		if dryRun {
+			l.Debug("dry run requested, skipping persistence and forwarding")
+			ctx = withDryRun(ctx)
+		}
+
+		res, err := processor.ProcessWebhook(ctx, jsonData)
+
+		// unhandled events share a label so senders can't blow up the number
+		// of series
+		switch {
+		case res.Outcome == outcomeIgnored:
+			event = "unhandled"
+		case res.Event != "":
+			event = res.Event
+		}
+
+		if res.Outcome == outcomeDuplicate {
+			metrics.observeDuplicate(res.Event)
+		}
+
+		// only deliveries that parsed make it into the buffer, the status is
+		// whatever we end up answering
+		if res.Event != "" {
+			received := RecentEvent{
+				RequestID:  requestIDFromContext(r.Context()),
+				Provider:   providerName,
+				Event:      res.Event,
+				ReceivedAt: clock.Now().UTC(),
+				Payload:    jsonData,
+			}
+			defer func() {
+				received.Status = rec.status
+				recent.Add(received)
+			}()
+		}
+
+		if err != nil {
+			writeProcessError(w, l, res.Event, err)
+			return
+		}
+
+		if dryRun {
+			res.Body = dryRunReport{DryRun: true, Event: res.Event, Outcome: res.Outcome, Result: res.Body}
+		}
+		writeResult(w, l, res.HandlerResult)
+	}
+}
+
+// writeHandlerError answers with the status ackPolicy picks for err,
+// payloads we couldn't parse are the sender's fault and get a 400 and
+// payloads that parse but fail validation get a 422
+func writeHandlerError(w http.ResponseWriter, l *slog.Logger, event string, err error) {
+	switch status := ackPolicy(err); status {
+	case http.StatusUnprocessableEntity:
+		var validationErr *ValidationError
+		errors.As(err, &validationErr)
+		l.Info("event payload failed validation", "event", event, "error context", err)
+		writeError(w, l, APIError{Code: status, Message: "payload failed validation", Details: validationErr.Fields})
+	case http.StatusServiceUnavailable, statusClientClosedRequest:
+		writeContextError(w, l, err)
+	case http.StatusBadGateway:
+		// only reached under ack-on-success, the sender retrying is the point
+		l.Warn("event handled but not forwarded, asking the sender to retry", "event", event, "error context", err)
+		writeError(w, l, APIError{Code: status, Message: "error forwarding event"})
+	case http.StatusBadRequest:
+		l.Info("invalid event payload", "event", event, "error context", err)
+		writeError(w, l, APIError{Code: status, Message: err.Error()})
+	default:
+		l.Error("error handling event", "event", event, "error context", err)
+		writeError(w, l, APIError{Code: status, Message: "error handling event"})
+	}
+}
+
+// statusClientClosedRequest is the nginx convention for a client that went
+// away before we answered, it only ever shows up in logs and metrics
+const statusClientClosedRequest = 499
+
+// writeContextError answers requests whose context ended mid flight and
+// reports whether err was one of those. a request that ran out of time gets
+// a 503 so the sender retries it, a client that hung up gets nothing since
+// nobody is listening
+func writeContextError(w http.ResponseWriter, l *slog.Logger, err error) bool {
+	switch status := ackPolicy(err); {
+	case errors.Is(err, context.DeadlineExceeded):
+		l.Warn("request timed out", "error context", err)
+		writeError(w, l, APIError{Code: status, Message: "request timed out"})
+		return true
+	case errors.Is(err, context.Canceled):
+		l.Info("client went away before the request finished", "error context", err)
+		w.WriteHeader(status)
+		return true
+	}
+
+	return false
+}
+
+// ListEvents serves the stored webhooks, filtered by the optional event,
+// since, until (RFC3339) and limit query parameters
+func ListEvents(l *slog.Logger, store EventStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := Filter{Event: query.Get("event")}
+
+		var err error
+		if v := query.Get("since"); v != "" {
+			if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+				writeError(w, l, APIError{Code: http.StatusBadRequest, Message: "since must be an RFC3339 timestamp"})
+				return
+			}
+		}
+
+		if v := query.Get("until"); v != "" {
+			if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+				writeError(w, l, APIError{Code: http.StatusBadRequest, Message: "until must be an RFC3339 timestamp"})
+				return
+			}
+		}
+
+		if v := query.Get("limit"); v != "" {
+			if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+				writeError(w, l, APIError{Code: http.StatusBadRequest, Message: "limit must be a non-negative integer"})
+				return
+			}
+		}
+
+		events, err := store.List(r.Context(), filter)
+		if err != nil {
+			if writeContextError(w, l, err) {
+				return
+			}
+
+			l.Error("error listing stored events", "error context", err)
+			writeError(w, l, APIError{Code: http.StatusInternalServerError, Message: "error listing events"})
+			return
+		}
+
+		writeJSON(w, l, http.StatusOK, events)
+	}
+}
+
+// ReplayEvent serves POST /events/{id}/replay, it feeds a stored webhook back
+// through its event handler without storing another copy of it
+func ReplayEvent(l *slog.Logger, router *EventRouter, store EventStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := l.With("request_id", requestIDFromContext(r.Context()))
+
+		id, ok := replayEventID(r.URL.Path)
+		if !ok {
+			writeError(w, l, APIError{Code: http.StatusNotFound, Message: "not found"})
+			return
+		}
+
+		stored, err := store.Get(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, ErrEventNotFound) {
+				writeError(w, l, APIError{Code: http.StatusNotFound, Message: "event not found", Details: map[string]string{"id": id}})
+				return
+			}
+
+			if writeContextError(w, l, err) {
+				return
+			}
+
+			l.Error("error loading stored event", "id", id, "error context", err)
+			writeError(w, l, APIError{Code: http.StatusInternalServerError, Message: "error loading event"})
+			return
+		}
+
+		l.Info("replaying stored event", "id", id, "event", stored.Event)
+
+		handler, ok := router.Lookup(stored.Event)
+		if !ok {
+			writeJSON(w, l, http.StatusOK, map[string]string{"status": "ignored", "event": stored.Event})
+			return
+		}
+
+		result, err := handler(r.Context(), stored.Raw)
+		if err != nil {
+			writeHandlerError(w, l, stored.Event, err)
+			return
+		}
+
+		writeResult(w, l, result)
+	}
+}
+
+// replayEventID pulls the id out of /events/{id}/replay
+func replayEventID(path string) (string, bool) {
+	id, ok := strings.CutPrefix(path, "/events/")
+	if !ok {
+		return "", false
+	}
+
+	id, ok = strings.CutSuffix(id, "/replay")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+
+	return id, true
+}
+
+// ListDeadLetters serves the forwards that ran out of retries so they can be
+// inspected and pushed downstream by hand
+func ListDeadLetters(l *slog.Logger, forwarder DeadLetterer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, l, http.StatusOK, forwarder.DeadLetters())
+	}
+}
+
+// ListRecentEvents serves the latest webhooks from the ring buffer, newest
+// first. n picks how many (10 by default) and payloads are redacted the same
+// way they are in the debug logs
+func ListRecentEvents(l *slog.Logger, recent *RecentEvents, redactPaths []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := 10
+		if v := r.URL.Query().Get("n"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil || n < 0 {
+				writeError(w, l, APIError{Code: http.StatusBadRequest, Message: "n must be a non-negative integer"})
+				return
+			}
+		}
+
+		events := recent.Last(n)
+		for i := range events {
+			events[i].Payload = redactJSON(events[i].Payload, redactPaths)
+		}
+
+		writeJSON(w, l, http.StatusOK, events)
+	}
+}
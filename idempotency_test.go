@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryIdempotencyStoreExpires(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC))
+	store := NewMemoryIdempotencyStore(clock, time.Minute)
+
+	seen := func() bool {
+		t.Helper()
+
+		ok, err := store.Seen("charge.success:1")
+		if err != nil {
+			t.Fatalf("checking key: %v", err)
+		}
+		return ok
+	}
+
+	if seen() {
+		t.Fatal("key seen before it was marked")
+	}
+
+	store.Mark("charge.success:1")
+	clock.Advance(time.Minute)
+	if !seen() {
+		t.Error("key forgotten before its TTL ran out")
+	}
+
+	clock.Advance(time.Second)
+	if seen() {
+		t.Error("key still seen after its TTL ran out")
+	}
+}
+
+func TestMemoryIdempotencyStoreSweeps(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC))
+	store := NewMemoryIdempotencyStore(clock, time.Minute)
+
+	store.Mark("old")
+	clock.Advance(2 * time.Minute)
+	store.Mark("new")
+
+	// nothing looked "old" up again, the sweep in Mark has to drop it
+	if _, ok := store.keys["old"]; ok {
+		t.Error("expired key survived the sweep")
+	}
+	if _, ok := store.keys["new"]; !ok {
+		t.Error("sweep dropped a live key")
+	}
+}
+
+func TestPayloadIdempotencyKeyUpdates(t *testing.T) {
+	pending := []byte(`{"event":"invoice.update","data":{"id":4516,"status":"pending"}}`)
+	success := []byte(`{"event":"invoice.update","data":{"id":4516,"status":"success"}}`)
+
+	if payloadIdempotencyKey("invoice.update", pending) == payloadIdempotencyKey("invoice.update", success) {
+		t.Error("two different updates of one invoice share a key")
+	}
+	if payloadIdempotencyKey("invoice.update", pending) != payloadIdempotencyKey("invoice.update", pending) {
+		t.Error("a retried update got a new key")
+	}
+
+	// everything else is still keyed on data.id alone
+	if payloadIdempotencyKey("invoice.create", pending) != payloadIdempotencyKey("invoice.create", success) {
+		t.Error("invoice.create keyed on more than data.id")
+	}
+}
+
+func TestPayloadIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"numeric id", `{"data":{"id":302961}}`, "charge.success:302961"},
+		{"string id", `{"data":{"id":"evt_1"}}`, `charge.success:"evt_1"`},
+		{"null id", `{"data":{"id":null}}`, ""},
+		{"no id", `{"data":{}}`, ""},
+		{"not json", `{"data":`, ""},
+		{"no data", `{}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := payloadIdempotencyKey("charge.success", []byte(tt.raw)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// InvoiceData is the data block of the invoice.* events
+type InvoiceData struct {
+	ID            int           `json:"id"`
+	Domain        string        `json:"domain"`
+	InvoiceCode   string        `json:"invoice_code"`
+	Amount        Amount        `json:"amount"`
+	Currency      string        `json:"currency"`
+	Status        PaymentStatus `json:"status"`
+	Paid          bool          `json:"paid"`
+	PaidAt        NullTime      `json:"paid_at"`
+	DueDate       NullTime      `json:"due_date"`
+	PeriodStart   NullTime      `json:"period_start"`
+	PeriodEnd     NullTime      `json:"period_end"`
+	Description   NullString    `json:"description"`
+	Customer      Customer      `json:"customer"`
+	Authorization Authorization `json:"authorization"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// invoiceEvent is invoice.create and invoice.update, both carry the whole
+// invoice as it stands after the change
+type invoiceEvent struct {
+	Event string      `json:"event"`
+	Data  InvoiceData `json:"data"`
+}
+
+func (i invoiceEvent) EventName() string { return i.Event }
+
+func (i invoiceEvent) Validate() error {
+	var v validator
+	v.check(i.Data.InvoiceCode != "", "data.invoice_code", "is required")
+	v.check(i.Data.Amount > 0, "data.amount", "must be greater than zero")
+	v.status(i.Data.Status, "data.status", paymentRequestStatuses...)
+
+	return v.err(i.Event)
+}
+
+// Money returns the invoiced amount with its currency
+func (i invoiceEvent) Money() Money {
+	return Money{Minor: int64(i.Data.Amount), Currency: i.Data.Currency}
+}
+
+// Normalize uses the invoice code as the reference
+func (i invoiceEvent) Normalize() NormalizedEvent {
+	occurredAt := i.Data.CreatedAt
+	if i.Data.PaidAt.Valid {
+		occurredAt = i.Data.PaidAt.Time
+	}
+
+	return NormalizedEvent{
+		Type:        i.Event,
+		Reference:   i.Data.InvoiceCode,
+		AmountMinor: i.Money().Minor,
+		Currency:    i.Money().Currency,
+		Status:      string(i.Data.Status),
+		OccurredAt:  occurredAt.UTC(),
+		Customer:    NormalizedCustomer{ID: i.Data.Customer.ID, Code: i.Data.Customer.Code, Email: i.Data.Customer.Email},
+	}
+}
+
+// HandleInvoice handles invoice.create and invoice.update, event is the one
+// it's registered for so decode errors name it before the payload is read
+func HandleInvoice(l *slog.Logger, event string, currencies CurrencyAllowList, strict bool) EventHandler {
+	return func(ctx context.Context, raw json.RawMessage) (HandlerResult, error) {
+		var invoice invoiceEvent
+
+		if err := unmarshalEvent(raw, event, &invoice, strict); err != nil {
+			l.Error("error marshalling invoice data", "error context", err)
+			return HandlerResult{}, err
+		}
+
+		l.Info("invoice hook event", "response event title", invoice.Event)
+
+		if err := invoice.Validate(); err != nil {
+			return HandlerResult{}, err
+		}
+
+		// invoices don't always say which currency they're in
+		if invoice.Data.Currency != "" {
+			if err := currencies.check(invoice.Event, invoice.Data.Currency); err != nil {
+				return HandlerResult{}, err
+			}
+		}
+
+		l.Info("invoice response data unmarshalled successfully", "invoice code", invoice.Data.InvoiceCode, "invoice status", invoice.Data.Status, "invoice amount", invoice.Money())
+
+		return handled(invoice.Normalize()), nil
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHandleInvoiceNamesTheEvent(t *testing.T) {
+	fixtures := loadFixtures(t)
+
+	for _, event := range []string{"invoice.create", "invoice.update"} {
+		t.Run(event, func(t *testing.T) {
+			// an unknown field fails strict decoding before the payload's
+			// own event name is known
+			raw := bytes.Replace(fixtures[event], []byte(`"data": {`), []byte(`"data": {"surprise": 1,`), 1)
+
+			_, err := HandleInvoice(discardLogger(), event, nil, true)(context.Background(), raw)
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("got %v, want a ValidationError", err)
+			}
+			if validationErr.Event != event || len(validationErr.Fields) != 1 || validationErr.Fields[0].Field != "surprise" {
+				t.Errorf("got %+v, want surprise reported against %s", validationErr, event)
+			}
+		})
+	}
+}
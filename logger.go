@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// newLogger builds a slog.Logger writing to w, format "json" picks the JSON
+// handler and anything else falls back to text
+func newLogger(format string, level slog.Level, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// parseLogLevel maps a LOG_LEVEL value to a slog.Level, unknown values
+// fall back to info
+func parseLogLevel(s string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo
+	}
+
+	return level
+}
+
+// openLogOutput resolves LOG_OUTPUT to a writer, "stdout" and "stderr" are
+// the process streams and anything else is a file path logs are appended
+// to. files are rotated once they grow past maxSize bytes, keeping backups
+// old files, and a maxSize of 0 lets the file grow forever
+func openLogOutput(output string, maxSize int64, backups int) (io.WriteCloser, error) {
+	switch output {
+	case "", "stdout":
+		return nopWriteCloser{os.Stdout}, nil
+	case "stderr":
+		return nopWriteCloser{os.Stderr}, nil
+	}
+
+	f := &rotatingFile{path: output, maxSize: maxSize, backups: backups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// nopWriteCloser keeps the process streams open when the log output is closed
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// rotatingFile is a log file that moves itself aside to path.1 once it's
+// full, path.1 goes to path.2 and so on, the oldest backup is dropped
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening log file: %w", err)
+	}
+
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write never splits p across files, so a record always ends up whole in
+// one of them. a rotation that fails but leaves the file open only costs
+// the rotation, the record still goes to the full file
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil && f.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file aside and opens a fresh one at path. once the old
+// file is closed every way out reopens path, f.file is only left nil when
+// that fails too
+func (f *rotatingFile) rotate() error {
+	if f.file != nil {
+		err := f.file.Close()
+		f.file = nil
+		if err != nil {
+			return fmt.Errorf("rotating log file: %w", err)
+		}
+	}
+
+	if err := f.moveAside(); err != nil {
+		err = fmt.Errorf("rotating log file: %w", err)
+		if openErr := f.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+
+	return f.open()
+}
+
+// moveAside shifts the backups up by one and the file to path.1, without
+// backups the file is just emptied
+func (f *rotatingFile) moveAside() error {
+	if f.backups == 0 {
+		return os.Truncate(f.path, 0)
+	}
+
+	for i := f.backups - 1; i > 0; i-- {
+		// missing backups are expected until the file has rotated enough
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+
+	return os.Rename(f.path, f.path+".1")
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	return f.file.Close()
+}
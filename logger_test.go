@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+
+	return string(b)
+}
+
+func TestRotatingFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := openLogOutput(path, 10, 2)
+	if err != nil {
+		t.Fatalf("opening: %v", err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("writing %q: %v", line, err)
+		}
+	}
+
+	for name, want := range map[string]string{path: "third\n", path + ".1": "second\n", path + ".2": "first\n"} {
+		if got := readLog(t, name); got != want {
+			t.Errorf("%s holds %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+}
+
+func TestRotatingFileKeepsWritingWhenRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := openLogOutput(path, 10, 1)
+	if err != nil {
+		t.Fatalf("opening: %v", err)
+	}
+	defer w.Close()
+
+	// a non empty directory where the backup goes makes the rename fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "taken"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("writing %q: %v", line, err)
+		}
+	}
+
+	if got := readLog(t, path); got != "first\nsecond\nthird\n" {
+		t.Errorf("log holds %q, want every line", got)
+	}
+}
@@ -1,150 +1,71 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"log/slog"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 func main() {
-	// setup a logger using slog
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-
-	logger.Info("Hello Terminal 👋", "user", os.Getenv("USER"))
+	startTime = time.Now()
 
-	http.HandleFunc("/health", HealthCheck(logger))
-	http.HandleFunc("/dynamic-hook", HandleDynamicAPI(logger))
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
 
-	go log.Fatal(http.ListenAndServe(":3000", nil))
-}
+	cfg, err := LoadConfigWithFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// the config decides the log format, so report this one as plain text
+		newLogger("text", slog.LevelInfo, os.Stderr).Error("invalid configuration", "error context", err)
+		os.Exit(1)
+	}
 
-// this will be used to identify the event type
-//
-// we care about just the event head
-type eventIdentfier struct {
-	Event string `json:"event"`
-}
+	logOutput, err := openLogOutput(cfg.LogOutput, cfg.LogMaxSize, cfg.LogMaxBackups)
+	if err != nil {
+		newLogger("text", slog.LevelInfo, os.Stderr).Error("error opening log output", "error context", err)
+		os.Exit(1)
+	}
+	defer logOutput.Close()
 
-type paymentPending struct {
-	Event string `json:"event"`
-	Data  struct {
-		ID               int       `json:"id"`
-		Domain           string    `json:"domain"`
-		Amount           int       `json:"amount"`
-		Currency         string    `json:"currency"`
-		DueDate          any       `json:"due_date"`
-		HasInvoice       bool      `json:"has_invoice"`
-		InvoiceNumber    any       `json:"invoice_number"`
-		Description      string    `json:"description"`
-		PdfURL           any       `json:"pdf_url"`
-		LineItems        []any     `json:"line_items"`
-		Tax              []any     `json:"tax"`
-		RequestCode      string    `json:"request_code"`
-		Status           string    `json:"status"`
-		Paid             bool      `json:"paid"`
-		PaidAt           any       `json:"paid_at"`
-		Metadata         any       `json:"metadata"`
-		Notifications    []any     `json:"notifications"`
-		OfflineReference string    `json:"offline_reference"`
-		Customer         int       `json:"customer"`
-		CreatedAt        time.Time `json:"created_at"`
-	} `json:"data"`
-}
+	// setup a logger using slog
+	logger := newLogger(cfg.LogFormat, cfg.LogLevel, logOutput)
 
-type paymentSuccessful struct {
-	Event string `json:"event"`
-	Data  struct {
-		ID            int       `json:"id"`
-		Domain        string    `json:"domain"`
-		Amount        int       `json:"amount"`
-		Currency      string    `json:"currency"`
-		DueDate       any       `json:"due_date"`
-		HasInvoice    bool      `json:"has_invoice"`
-		InvoiceNumber any       `json:"invoice_number"`
-		Description   string    `json:"description"`
-		PdfURL        any       `json:"pdf_url"`
-		LineItems     []any     `json:"line_items"`
-		Tax           []any     `json:"tax"`
-		RequestCode   string    `json:"request_code"`
-		Status        string    `json:"status"`
-		Paid          bool      `json:"paid"`
-		PaidAt        time.Time `json:"paid_at"`
-		Metadata      any       `json:"metadata"`
-		Notifications []struct {
-			SentAt  time.Time `json:"sent_at"`
-			Channel string    `json:"channel"`
-		} `json:"notifications"`
-		OfflineReference string    `json:"offline_reference"`
-		Customer         int       `json:"customer"`
-		CreatedAt        time.Time `json:"created_at"`
-	} `json:"data"`
-}
+	logger.Info("Hello Terminal 👋", "user", os.Getenv("USER"), "version", version, "commit", commit)
 
-func HealthCheck(l *slog.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if err := json.NewEncoder(w).Encode(map[string]string{"data": "Hello from localhost:3000"}); err != nil {
-			l.Error("error encoding data to send as response", "error context", err)
-			return
-		}
+	srv, err := NewServer(cfg, WithLogger(logger))
+	if err != nil {
+		logger.Error("error setting up server", "error context", err)
+		os.Exit(1)
 	}
-}
-
-func HandleDynamicAPI(l *slog.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		l.Info("This API is connected", "user", os.Getenv("USER"))
-		var (
-			eventIdentfier    eventIdentfier
-			jsonData          json.RawMessage
-			paymentPending    paymentPending
-			paymentSuccessful paymentSuccessful
-		)
-
-		if err := json.NewDecoder(r.Body).Decode(&jsonData); err != nil {
-			l.Error("error decoding json response", "error context", err)
-			return
-		}
 
-		if err := json.Unmarshal(jsonData, &eventIdentfier); err != nil {
-			l.Error("error unmarshalling json data message", "error context", err)
-			return
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			log.Fatal(err)
 		}
+	}()
 
-		switch eventIdentfier.Event {
-		case "paymentrequest.pending":
-			l.Info("payment pending hook event", "response event title", eventIdentfier.Event)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-			if err := json.Unmarshal(jsonData, &paymentPending); err != nil {
-				l.Error("error marshalling pending payment data", "error context", err)
-				return
-			}
+	<-ctx.Done()
+	logger.Info("shutdown signal received, draining in-flight requests", "timeout", cfg.ShutdownTimeout)
 
-			w.Header().Add("Content-Type", "application/json")
-			if err := json.NewEncoder(w).Encode(map[string]any{"event type": paymentPending.Event, "amount": paymentPending.Data.Amount}); err != nil {
-				l.Error("error encoding data to send as response", "error context", err)
-				return
-			}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 
-			l.Info("pending response data unmarshalled successfully", "pending ID", paymentPending.Data.ID, "pending amount", paymentPending.Data.Amount)
-		case "paymentrequest.success":
-			l.Info("payment successful hook event", "response event title", eventIdentfier.Event)
-
-			if err := json.Unmarshal(jsonData, &paymentSuccessful); err != nil {
-				l.Error("error marshalling successful payment data", "error context", err)
-				return
-			}
-
-			w.Header().Add("Content-Type", "application/json")
-			if err := json.NewEncoder(w).Encode(map[string]any{"event type": paymentSuccessful.Event, "description": paymentSuccessful.Data.Description}); err != nil {
-				return
-			}
-
-			l.Info("success response data unmarshalled successfully", "success ID", paymentSuccessful.Data.ID, "success amount", paymentSuccessful.Data.Amount)
-		default:
-			l.Info("no event type found", "response event title", eventIdentfier.Event)
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("error shutting down server", "error context", err)
+		return
 	}
+
+	logger.Info("server stopped")
 }
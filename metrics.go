@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// there is no prometheus client in our deps, so this is a small stand in
+// that renders the prometheus text exposition format for the handful of
+// metrics we keep
+
+// collector is anything that can render itself in the exposition format
+type collector interface {
+	writeTo(w io.Writer)
+}
+
+// Metrics holds every metric the service exposes on /metrics
+type Metrics struct {
+	collectors []collector
+
+	events     *counterVec
+	latency    *histogram
+	duplicates *counterVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		events:     newCounterVec("webhook_events_total", "Webhook deliveries handled, by event and response status.", "event", "status"),
+		latency:    newHistogram("webhook_handler_duration_seconds", "Time spent handling a webhook delivery.", defaultBuckets),
+		duplicates: newCounterVec("webhook_duplicates_total", "Deliveries skipped because the idempotency store had already seen them, by event.", "event"),
+	}
+	m.collectors = []collector{m.events, m.latency, m.duplicates}
+
+	return m
+}
+
+// Handler serves the metrics in the prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, c := range m.collectors {
+			c.writeTo(w)
+		}
+	})
+}
+
+// watchBreaker reports the state of b as forward_circuit_state
+func (m *Metrics) watchBreaker(b *CircuitBreaker) {
+	m.collectors = append(m.collectors, &gaugeFunc{
+		name: "forward_circuit_state",
+		help: "State of the forward circuit breaker, 0 closed, 1 half-open, 2 open.",
+		fn:   func() float64 { return float64(b.State()) },
+	})
+}
+
+// watchDeadLetters reports how many dead letters d dropped to stay within
+// DEAD_LETTER_SIZE as forward_dead_letters_dropped_total
+func (m *Metrics) watchDeadLetters(d DeadLetterer) {
+	m.collectors = append(m.collectors, &counterFunc{
+		name: "forward_dead_letters_dropped_total",
+		help: "Dead letters dropped to make room for newer ones.",
+		fn:   func() float64 { return float64(d.DeadLettersDropped()) },
+	})
+}
+
+// watchBatch reports the events b turned away with a full backlog as
+// forward_batch_rejected_total
+func (m *Metrics) watchBatch(b *BatchForwarder) {
+	m.collectors = append(m.collectors, &counterFunc{
+		name: "forward_batch_rejected_total",
+		help: "Events dead lettered without a send because the batch backlog was full.",
+		fn:   func() float64 { return float64(b.Rejected()) },
+	})
+}
+
+// observeEvent records a handled delivery and how long it took
+func (m *Metrics) observeEvent(event string, status int, elapsed time.Duration) {
+	m.events.inc(event, fmt.Sprint(status))
+	m.latency.observe(elapsed.Seconds())
+}
+
+// observeDuplicate records a delivery that was skipped as a retry of one we
+// already processed
+func (m *Metrics) observeDuplicate(event string) {
+	m.duplicates.inc(event)
+}
+
+type counterVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// inc bumps the counter for the given label values, they must be passed in
+// the same order the labels were declared
+func (c *counterVec) inc(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[strings.Join(values, "\xff")]++
+}
+
+func (c *counterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		values := strings.Split(k, "\xff")
+		pairs := make([]string, len(c.labels))
+		for i, label := range c.labels {
+			pairs[i] = fmt.Sprintf(`%s="%s"`, label, labelEscaper.Replace(values[i]))
+		}
+		fmt.Fprintf(w, "%s{%s} %v\n", c.name, strings.Join(pairs, ","), c.values[k])
+	}
+}
+
+// gaugeFunc reads its value when it's scraped
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (g *gaugeFunc) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", g.name, g.help, g.name, g.name, g.fn())
+}
+
+// counterFunc is a counter kept somewhere else, read when it's scraped
+type counterFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (c *counterFunc) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %v\n", c.name, c.help, c.name, c.name, c.fn())
+}
+
+// defaultBuckets mirrors the prometheus client defaults, in seconds
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	return &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%v\"} %d\n", h.name, upper, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %v\n%s_count %d\n", h.name, h.sum, h.name, h.count)
+}
+
+// labelEscaper escapes label values the way the exposition format expects
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Chain composes middlewares so the first one listed is the outermost, i.e.
+// Chain(a, b, c)(h) is a(b(c(h))) and a request passes a, then b, then c.
+//
+// the server applies them in this order:
+//
+//	PrettyJSON -> Recover -> RequestID -> Trace -> LogRequests -> LimitHeaders -> LimitRequestsPerConn -> Timeout -> per route guards -> handler
+//
+// webhook auth happens in the handler itself, since verifying a delivery
+// depends on which provider sent it
+func Chain(middlewares ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+
+		return h
+	}
+}
+
+// LogRequests writes an access log line for every request once the handler
+// is done, with the status it actually wrote
+func LogRequests(l *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started := time.Now()
+			rec := newStatusRecorder(w)
+
+			next.ServeHTTP(rec, r)
+
+			l.Info("request served",
+				"request_id", requestIDFromContext(r.Context()),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rec.status,
+				"bytes", rec.bytes,
+				"duration", time.Since(started),
+			)
+		})
+	}
+}
+
+// LimitBody caps the request body at maxBytes. a declared Content-Length
+// over the limit is turned away before reading anything, but chunked bodies
+// don't declare one, so the real enforcement happens while reading: readers
+// further down get an *http.MaxBytesError once the limit is crossed
+func LimitBody(l *slog.Logger, maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				l.Info("request body too large", "limit", maxBytes, "content length", r.ContentLength)
+				writeError(w, l, APIError{Code: http.StatusRequestEntityTooLarge, Message: "request body too large", Details: map[string]int64{"limit": maxBytes}})
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timeout gives every request a deadline of d, the context is what stores and
+// forwarders watch so slow work is abandoned once it passes. d <= 0 leaves
+// requests without a deadline
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// LimitHeaders answers requests carrying more than maxCount header lines with
+// a 431, the server's MaxHeaderBytes already bounds their total size. a
+// maxCount of 0 or less turns it off
+func LimitHeaders(l *slog.Logger, maxCount int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if maxCount <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count := 0
+			for _, values := range r.Header {
+				count += len(values)
+			}
+
+			if count > maxCount {
+				l.Info("rejected request with too many headers", "headers", count, "limit", maxCount)
+				writeError(w, l, APIError{Code: http.StatusRequestHeaderFieldsTooLarge, Message: "too many headers", Details: map[string]int{"limit": maxCount}})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LimitConcurrency lets at most n requests through at once, the rest get a
+// 503 with a Retry-After straight away instead of piling up behind a slow
+// store or downstream. the n slots are shared by every handler it wraps, an
+// n of 0 or less turns it off
+func LimitConcurrency(l *slog.Logger, n int) func(http.Handler) http.Handler {
+	if n <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	slots := make(chan struct{}, n)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				l.Warn("too many webhooks in flight, turning request away", "limit", n)
+				w.Header().Set("Retry-After", "1")
+				writeError(w, l, APIError{Code: http.StatusServiceUnavailable, Message: "server busy"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type connRequestsKey struct{}
+
+// countConnRequests is an http.Server ConnContext, it gives every
+// connection a counter for LimitRequestsPerConn
+func countConnRequests(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsKey{}, new(atomic.Int64))
+}
+
+// LimitRequestsPerConn asks for the connection to be closed once it has
+// served n requests, so one keep-alive connection can't be used to hammer
+// us forever. the nth request is still served, with Connection: close, and
+// the client has to reconnect for the next one. n of 0 turns it off
+func LimitRequestsPerConn(l *slog.Logger, n int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if n == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// only connections accepted by a server set up with
+			// countConnRequests are counted
+			if count, ok := r.Context().Value(connRequestsKey{}).(*atomic.Int64); ok && count.Add(1) >= int64(n) {
+				l.Debug("connection reached its request limit, closing it", "limit", n, "remote addr", r.RemoteAddr)
+				w.Header().Set("Connection", "close")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AllowMethods answers any method outside methods with a 405 and an Allow
+// header listing the accepted ones
+func AllowMethods(l *slog.Logger, methods ...string) func(http.Handler) http.Handler {
+	allow := strings.Join(methods, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, method := range methods {
+				if r.Method == method {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			w.Header().Set("Allow", allow)
+			writeError(w, l, APIError{Code: http.StatusMethodNotAllowed, Message: "method not allowed", Details: map[string]string{"allow": allow}})
+		})
+	}
+}
+
+// RequireContentType rejects requests that don't declare a body of
+// mediaType with a 415, parameters such as charset are allowed
+func RequireContentType(l *slog.Logger, mediaType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType := r.Header.Get("Content-Type")
+
+			got, _, err := mime.ParseMediaType(contentType)
+			if err != nil || got != mediaType {
+				l.Info("rejected webhook with unsupported content type", "content type", contentType)
+				writeError(w, l, APIError{Code: http.StatusUnsupportedMediaType, Message: "content type must be " + mediaType, Details: map[string]string{"content_type": contentType}})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Decompress inflates gzip and deflate encoded bodies before they reach the
+// signature check and the JSON decoder.
+//
+// the decompressed stream is capped at maxBytes too, otherwise a tiny gzip
+// bomb would sail through LimitBody and expand in memory
+func Decompress(l *slog.Logger, maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				zr  io.ReadCloser
+				err error
+			)
+
+			switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+			case "gzip", "x-gzip":
+				zr, err = gzip.NewReader(r.Body)
+			case "deflate":
+				zr, err = zlib.NewReader(r.Body)
+			default:
+				writeError(w, l, APIError{Code: http.StatusUnsupportedMediaType, Message: "unsupported content encoding", Details: map[string]string{"content_encoding": encoding}})
+				return
+			}
+
+			// the gzip header is read up front, so a tiny limit can trip here
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeError(w, l, APIError{Code: http.StatusRequestEntityTooLarge, Message: "request body too large", Details: map[string]int64{"limit": maxBytesErr.Limit}})
+				return
+			}
+
+			if err != nil {
+				l.Info("error reading compressed request body", "error context", err)
+				writeError(w, l, APIError{Code: http.StatusBadRequest, Message: "malformed compressed body"})
+				return
+			}
+
+			r.Body = &decompressedBody{Reader: http.MaxBytesReader(w, zr, maxBytes), zr: zr, body: r.Body}
+			r.Header.Del("Content-Encoding")
+			r.ContentLength = -1
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// decompressedBody closes both the decompressor and the original body
+type decompressedBody struct {
+	io.Reader
+	zr   io.Closer
+	body io.Closer
+}
+
+func (d *decompressedBody) Close() error {
+	d.zr.Close()
+	return d.body.Close()
+}
+
+// Recover turns a panic in any handler down the chain into a logged stack
+// trace and a 500, instead of letting it take the connection down
+func Recover(l *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+
+				// net/http uses this one to abort a response on purpose
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				l.Error("recovered from panic in handler", "path", r.URL.Path, "panic", rec, "stack", string(debug.Stack()))
+				writeError(w, l, APIError{Code: http.StatusInternalServerError, Message: "internal server error"})
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// statusRecorder remembers the status code and how many body bytes were
+// written through it, handlers that never call WriteHeader get the implicit 200
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader only records the first call, later ones are ignored by
+// net/http as well
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status, sr.wroteHeader = status, true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	sr.wroteHeader = true
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
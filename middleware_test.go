@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimitsOffAtZero(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for name, limit := range map[string]func(http.Handler) http.Handler{
+		"LimitHeaders":     LimitHeaders(discardLogger(), 0),
+		"LimitConcurrency": LimitConcurrency(discardLogger(), 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/dynamic-hook", nil)
+			req.Header.Set("X-One", "1")
+
+			rec := httptest.NewRecorder()
+			limit(ok).ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("answered %d with the limit at 0: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestLimitHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	req := httptest.NewRequest(http.MethodPost, "/dynamic-hook", nil)
+	req.Header.Add("X-One", "1")
+	req.Header.Add("X-One", "2")
+
+	rec := httptest.NewRecorder()
+	LimitHeaders(discardLogger(), 1)(ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("answered %d, want 431", rec.Code)
+	}
+}
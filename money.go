@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Money is an amount in the currency's minor unit (kobo for NGN, cents for
+// USD) along with the currency code, so nobody has to guess the unit
+type Money struct {
+	Minor    int64  `json:"amount_minor"`
+	Currency string `json:"currency"`
+}
+
+// zeroDecimalCurrencies have no minor unit, every other currency we see
+// uses two decimal places
+var zeroDecimalCurrencies = map[string]bool{
+	"JPY": true, "KRW": true, "UGX": true, "RWF": true, "XAF": true, "XOF": true,
+}
+
+// exponent is how many decimal places the currency's major unit has
+func (m Money) exponent() int {
+	if zeroDecimalCurrencies[strings.ToUpper(m.Currency)] {
+		return 0
+	}
+
+	return 2
+}
+
+// Major returns the amount in the major unit, e.g. 150050 kobo is 1500.5
+// naira. use it for display only, the minor amount is the exact one
+func (m Money) Major() float64 {
+	major := float64(m.Minor)
+	for i := 0; i < m.exponent(); i++ {
+		major /= 10
+	}
+
+	return major
+}
+
+// String formats the amount in the major unit with the currency's decimal
+// places, e.g. "NGN 1500.50"
+func (m Money) String() string {
+	exp := m.exponent()
+	if exp == 0 {
+		return fmt.Sprintf("%s %d", m.Currency, m.Minor)
+	}
+
+	sign, minor := "", m.Minor
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+
+	scale := int64(1)
+	for i := 0; i < exp; i++ {
+		scale *= 10
+	}
+
+	return fmt.Sprintf("%s %s%d.%0*d", m.Currency, sign, minor/scale, exp, minor%scale)
+}
+
+// Money returns the payment request amount with its currency
+func (d PaymentRequestData) Money() Money {
+	return Money{Minor: int64(d.Amount), Currency: d.Currency}
+}
+
+// Money returns the charged amount with its currency
+func (c chargeSuccess) Money() Money {
+	return Money{Minor: int64(c.Data.Amount), Currency: c.Data.Currency}
+}
@@ -0,0 +1,69 @@
+package main
+
+import "time"
+
+// NormalizedEvent is the provider agnostic shape we answer webhooks with and
+// relay downstream, so consumers don't have to know each payload's quirks
+type NormalizedEvent struct {
+	Type        string             `json:"type"`
+	Reference   string             `json:"reference"`
+	AmountMinor int64              `json:"amount_minor"`
+	Currency    string             `json:"currency"`
+	Status      string             `json:"status"`
+	OccurredAt  time.Time          `json:"occurred_at"`
+	Customer    NormalizedCustomer `json:"customer"`
+}
+
+// NormalizedCustomer carries whatever the provider told us about the payer
+type NormalizedCustomer struct {
+	ID    int    `json:"id,omitempty"`
+	Code  string `json:"code,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// normalize maps the data shared by the payment request events, the event
+// happened when the payment was made or, failing that, when it was created
+func (d PaymentRequestData) normalize(event string) NormalizedEvent {
+	occurredAt := d.CreatedAt
+	if d.PaidAt.Valid {
+		occurredAt = d.PaidAt.Time
+	}
+
+	return NormalizedEvent{
+		Type:        event,
+		Reference:   d.RequestCode,
+		AmountMinor: d.Money().Minor,
+		Currency:    d.Money().Currency,
+		Status:      string(d.Status),
+		OccurredAt:  occurredAt.UTC(),
+		Customer:    NormalizedCustomer{ID: d.Customer.ID, Code: d.Customer.Code, Email: d.Customer.Email},
+	}
+}
+
+func (p paymentPending) Normalize() NormalizedEvent {
+	return p.Data.normalize(p.Event)
+}
+
+func (p paymentSuccessful) Normalize() NormalizedEvent {
+	return p.Data.normalize(p.Event)
+}
+
+func (p paymentExpired) Normalize() NormalizedEvent {
+	return p.Data.normalize(p.Event)
+}
+
+func (c chargeSuccess) Normalize() NormalizedEvent {
+	return NormalizedEvent{
+		Type:        c.Event,
+		Reference:   c.Data.Reference,
+		AmountMinor: c.Money().Minor,
+		Currency:    c.Money().Currency,
+		Status:      string(c.Data.Status),
+		OccurredAt:  c.Data.PaidAt.UTC(),
+		Customer: NormalizedCustomer{
+			ID:    c.Data.Customer.ID,
+			Code:  c.Data.Customer.CustomerCode,
+			Email: c.Data.Customer.Email,
+		},
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLPExporter batches ended spans and POSTs them to an OTLP/HTTP collector
+// using the JSON encoding, which any collector accepts on /v1/traces
+type OTLPExporter struct {
+	url     string
+	service string
+	client  *http.Client
+	l       *slog.Logger
+
+	mu      sync.Mutex
+	pending []*Span
+
+	flush chan struct{}
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// otlpBatchSize is how many spans trigger a flush before the interval is up
+const otlpBatchSize = 256
+
+// NewOTLPExporter starts exporting to endpoint, the collector base URL the
+// way OTEL_EXPORTER_OTLP_ENDPOINT has it, spans are flushed every interval
+func NewOTLPExporter(l *slog.Logger, endpoint, service string, interval time.Duration) *OTLPExporter {
+	e := &OTLPExporter{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		l:       l,
+		flush:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	e.wg.Add(1)
+	go e.run(interval)
+
+	return e
+}
+
+func (e *OTLPExporter) ExportSpan(s *Span) {
+	e.mu.Lock()
+	e.pending = append(e.pending, s)
+	full := len(e.pending) >= otlpBatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *OTLPExporter) run(interval time.Duration) {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			e.send()
+			return
+		case <-ticker.C:
+			e.send()
+		case <-e.flush:
+			e.send()
+		}
+	}
+}
+
+// send posts whatever is pending, a failed batch is logged and dropped since
+// traces aren't worth holding memory for
+func (e *OTLPExporter) send() {
+	e.mu.Lock()
+	spans := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		e.l.Error("error encoding spans", "error context", err)
+		return
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		e.l.Warn("error exporting spans", "spans", len(spans), "error context", err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		e.l.Warn("collector rejected spans", "spans", len(spans), "status", resp.Status)
+	}
+}
+
+// Close flushes the spans still pending and stops the exporter
+func (e *OTLPExporter) Close(ctx context.Context) error {
+	close(e.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// the OTLP JSON encoding, only the fields we fill in
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+// span kinds and status codes from the OTLP proto
+const (
+	otlpKindInternal = 1
+	otlpKindServer   = 2
+	otlpStatusOK     = 1
+	otlpStatusError  = 2
+)
+
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpAttribute, len(keys))
+	for i, k := range keys {
+		out[i].Key, out[i].Value.StringValue = k, attrs[k]
+	}
+
+	return out
+}
+
+func (e *OTLPExporter) encode(spans []*Span) any {
+	encoded := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		s.mu.Lock()
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.SpanID[:]),
+			Name:              s.Name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: fmt.Sprint(s.StartAt.UnixNano()),
+			EndTimeUnixNano:   fmt.Sprint(s.EndAt.UnixNano()),
+			Attributes:        otlpAttributes(s.Attrs),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if s.ParentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+		}
+		if s.Server {
+			out.Kind = otlpKindServer
+		}
+		if s.Err != nil {
+			out.Status = otlpStatus{Code: otlpStatusError, Message: s.Err.Error()}
+		}
+		s.mu.Unlock()
+
+		encoded[i] = out
+	}
+
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttributes(map[string]string{"service.name": e.service}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "webhook"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
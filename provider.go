@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidSignature is returned by Provider.Verify when a delivery isn't
+// signed by the provider
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Provider captures what differs between webhook senders: how deliveries are
+// signed and where the event name lives in the payload
+type Provider interface {
+	// Verify checks the delivery was sent by the provider, body is the raw
+	// request body
+	Verify(r *http.Request, body []byte) error
+	// EventName pulls the event name out of the raw payload
+	EventName(body []byte) (string, error)
+}
+
+// PayloadDecoder is implemented by providers whose request body isn't the
+// JSON payload itself. DecodePayload gets the body as it was signed and
+// returns the JSON everything after Verify works with
+type PayloadDecoder interface {
+	DecodePayload(body []byte) ([]byte, error)
+}
+
+// providerFromPath resolves the provider a webhook was posted to, the bare
+// /dynamic-hook route predates providers and stays an alias for paystack
+func providerFromPath(providers map[string]Provider, path string) (string, Provider, bool) {
+	name := "paystack"
+	if rest, ok := strings.CutPrefix(path, "/dynamic-hook/"); ok {
+		name = rest
+	}
+
+	provider, ok := providers[name]
+	return name, provider, ok
+}
+
+// ErrInvalidEvent is returned by EventName when the payload parses but the
+// event name is missing, empty or not a string
+var ErrInvalidEvent = fmt.Errorf("%w: missing or invalid event", ErrInvalidPayload)
+
+// defaultEventNamePath is where most providers put the event name
+const defaultEventNamePath EventNamePath = "event"
+
+// EventNamePath is the dot separated path of the event name in a payload,
+// e.g. "event" or "data.type". providers embed one to get their EventName
+type EventNamePath string
+
+// EventName reads the string at the path, only the objects along the way
+// are decoded and the rest of the payload is left as raw bytes. anything
+// short of a non-empty string there is ErrInvalidEvent
+func (p EventNamePath) EventName(body []byte) (string, error) {
+	raw := json.RawMessage(body)
+	for i, key := range strings.Split(string(p), ".") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			// the first pass covers the whole payload, so this is where
+			// malformed JSON and trailing data are caught
+			if i == 0 {
+				return "", fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+			}
+			return "", fmt.Errorf("%w: %s is not an object", ErrInvalidEvent, raw)
+		}
+
+		var ok bool
+		if raw, ok = obj[key]; !ok {
+			return "", fmt.Errorf("%w: no %s", ErrInvalidEvent, p)
+		}
+	}
+
+	// null unmarshals into a string without complaint
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil || string(raw) == "null" {
+		return "", fmt.Errorf("%w: %s must be a string, got %s", ErrInvalidEvent, p, raw)
+	}
+
+	if name == "" {
+		return "", fmt.Errorf("%w: %s is empty", ErrInvalidEvent, p)
+	}
+
+	return name, nil
+}
+
+// paystack signs every webhook with a HMAC-SHA512 of the raw body
+// using the account secret key and sends it in this header
+const paystackSignatureHeader = "X-Paystack-Signature"
+
+// PaystackProvider verifies X-Paystack-Signature and reads the top level
+// event field
+type PaystackProvider struct {
+	EventNamePath
+	secrets []string
+	l       *slog.Logger
+}
+
+// NewPaystackProvider accepts deliveries signed with any of secrets, more
+// than one is only needed while the secret is being rotated
+func NewPaystackProvider(l *slog.Logger, secrets ...string) *PaystackProvider {
+	return &PaystackProvider{EventNamePath: defaultEventNamePath, secrets: secrets, l: l}
+}
+
+func (p *PaystackProvider) Verify(r *http.Request, body []byte) error {
+	signature := r.Header.Get(paystackSignatureHeader)
+
+	// every key is tried even after a match so the time taken doesn't
+	// give away which key signed it
+	matched := -1
+	for i, secret := range p.secrets {
+		if validSignature(secret, body, signature) && matched < 0 {
+			matched = i
+		}
+	}
+
+	if matched < 0 {
+		return ErrInvalidSignature
+	}
+
+	p.l.Debug("webhook signature verified", "key index", matched)
+	return nil
+}
+
+// validSignature compares the hex encoded signature against the expected
+// HMAC in constant time
+func validSignature(secret string, body []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
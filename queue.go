@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrForwardQueueFull is returned by ForwardQueue.Forward when the backlog is
+// at capacity, the event goes straight to the dead letters
+var ErrForwardQueueFull = errors.New("forward queue is full")
+
+// forwardJob is one event waiting to be delivered downstream
+type forwardJob struct {
+	id       string
+	event    string
+	payload  any
+	attempts int
+	// span is the span the event was queued under, the delivery is traced
+	// as its child
+	span *Span
+}
+
+// DeadLetter is a forward that ran out of retries
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Event    string    `json:"event"`
+	Payload  any       `json:"payload"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// ForwardQueue hands events to a pool of workers that deliver them through
+// next, so a slow or failing downstream never holds up the inbound webhook.
+// failed deliveries are retried with exponential backoff and the ones that
+// exhaust their retries end up on the dead letter list
+type ForwardQueue struct {
+	next       Forwarder
+	l          *slog.Logger
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	jobs   chan forwardJob
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// closeMu guards closing jobs against a Forward sending on it
+	closeMu sync.RWMutex
+	closed  bool
+	dropped atomic.Int64
+
+	dead deadLetters
+}
+
+// NewForwardQueue starts workers goroutines delivering through next, at most
+// size events wait in the backlog and each is retried up to retries times.
+// the latest deadLetterSize dead letters are kept
+func NewForwardQueue(l *slog.Logger, next Forwarder, workers, size, retries, deadLetterSize int) *ForwardQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &ForwardQueue{
+		next:       next,
+		l:          l,
+		retries:    retries,
+		backoff:    time.Second,
+		maxBackoff: time.Minute,
+		jobs:       make(chan forwardJob, size),
+		ctx:        ctx,
+		cancel:     cancel,
+		dead:       deadLetters{max: deadLetterSize},
+	}
+
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	return q
+}
+
+// Forward queues the event and returns straight away, ctx only covers the
+// enqueue since the delivery outlives the request
+func (q *ForwardQueue) Forward(ctx context.Context, event string, payload any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	job := forwardJob{id: newUUID(), event: event, payload: payload, span: spanFromContext(ctx)}
+
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+
+	if q.closed {
+		return errors.New("forward queue is closed")
+	}
+
+	select {
+	case q.jobs <- job:
+		q.l.Debug("queued event for forwarding", "event", event, "job", job.id)
+		return nil
+	default:
+		// kept with the dead letters so it can still be pushed by hand
+		q.deadLetter(job, ErrForwardQueueFull)
+		return ErrForwardQueueFull
+	}
+}
+
+// work delivers jobs until the queue is closed and drained, once the drain
+// deadline has passed the leftovers are only counted
+func (q *ForwardQueue) work() {
+	defer q.wg.Done()
+
+	for job := range q.jobs {
+		if q.ctx.Err() != nil {
+			q.dropped.Add(1)
+			continue
+		}
+		q.deliver(job)
+	}
+}
+
+// deliver keeps retrying job until it goes through, runs out of retries or
+// the queue is closed
+func (q *ForwardQueue) deliver(job forwardJob) {
+	ctx, span := startSpan(withSpan(q.ctx, job.span), "webhook.forward")
+	span.SetAttribute("webhook.event", job.event)
+	defer span.End()
+
+	backoff := q.backoff
+	for {
+		job.attempts++
+
+		err := q.next.Forward(ctx, job.event, job.payload)
+		span.SetAttribute("forward.attempts", fmt.Sprint(job.attempts))
+		span.RecordError(err)
+		if err == nil {
+			q.l.Info("forwarded event", "event", job.event, "job", job.id, "attempts", job.attempts)
+			return
+		}
+
+		if q.ctx.Err() != nil {
+			q.l.Warn("forward queue closed mid delivery, dropping event", "event", job.event, "job", job.id)
+			q.dropped.Add(1)
+			return
+		}
+
+		// the downstream wasn't tried, so the job keeps its attempts and
+		// waits for the breaker to let it through
+		if errors.Is(err, ErrCircuitOpen) {
+			job.attempts--
+		}
+
+		if job.attempts > q.retries {
+			q.l.Error("forwarding failed for good, dead lettering event", "event", job.event, "job", job.id, "attempts", job.attempts, "error context", err)
+			q.deadLetter(job, err)
+			return
+		}
+
+		q.l.Info("forwarding failed, retrying later", "event", job.event, "job", job.id, "attempt", job.attempts, "backoff", backoff, "error context", err)
+
+		select {
+		case <-q.ctx.Done():
+			q.dropped.Add(1)
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, q.maxBackoff)
+	}
+}
+
+func (q *ForwardQueue) deadLetter(job forwardJob, err error) {
+	q.dead.add(DeadLetter{
+		ID:       job.id,
+		Event:    job.event,
+		Payload:  job.payload,
+		Attempts: job.attempts,
+		Error:    err.Error(),
+		FailedAt: time.Now().UTC(),
+	})
+}
+
+// DeadLetters returns the forwards that exhausted their retries or found the
+// queue full, oldest first
+func (q *ForwardQueue) DeadLetters() []DeadLetter {
+	if q == nil {
+		return []DeadLetter{}
+	}
+
+	return q.dead.list()
+}
+
+// DeadLettersDropped counts the dead letters pushed off the list to make
+// room for newer ones
+func (q *ForwardQueue) DeadLettersDropped() int64 {
+	if q == nil {
+		return 0
+	}
+
+	return q.dead.dropped.Load()
+}
+
+// DeadLetterer is a forwarder that keeps the events it gave up on
+type DeadLetterer interface {
+	DeadLetters() []DeadLetter
+	DeadLettersDropped() int64
+}
+
+// deadLetters is the list a DeadLetterer keeps, safe for concurrent use.
+// it holds the latest max entries so a downstream that stays down doesn't
+// grow it forever, older ones are dropped and counted
+type deadLetters struct {
+	mu      sync.Mutex
+	max     int
+	dead    []DeadLetter
+	dropped atomic.Int64
+}
+
+func (d *deadLetters) add(dl DeadLetter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dead = append(d.dead, dl)
+	if d.max > 0 && len(d.dead) > d.max {
+		// zeroed so the dropped payload can be collected before the
+		// backing array is reallocated
+		d.dead[0] = DeadLetter{}
+		d.dead = d.dead[1:]
+		d.dropped.Add(1)
+	}
+}
+
+func (d *deadLetters) list() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]DeadLetter{}, d.dead...)
+}
+
+// Close stops taking new events and lets the workers deliver what is
+// already queued. once ctx is done the remaining deliveries are abandoned
+// and Close reports how many events never made it downstream
+func (q *ForwardQueue) Close(ctx context.Context) error {
+	q.closeMu.Lock()
+	if q.closed {
+		q.closeMu.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.jobs)
+	q.closeMu.Unlock()
+
+	q.l.Info("draining forward queue", "queued", len(q.jobs))
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+	}
+	q.cancel()
+
+	if dropped := q.dropped.Load(); dropped > 0 {
+		q.l.Warn("forward queue closed before every event was delivered", "dropped", dropped)
+		return fmt.Errorf("forward queue: %d event(s) not delivered: %w", dropped, ctx.Err())
+	}
+
+	q.l.Info("forward queue drained")
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// blockingForwarder holds every forward until release is closed
+type blockingForwarder struct {
+	release chan struct{}
+}
+
+func (f blockingForwarder) Forward(ctx context.Context, _ string, _ any) error {
+	select {
+	case <-f.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestForwardQueueCapsDeadLetters(t *testing.T) {
+	fwd := blockingForwarder{release: make(chan struct{})}
+	q := NewForwardQueue(discardLogger(), fwd, 1, 1, 0, 2)
+	defer q.Close(context.Background())
+	defer close(fwd.release)
+
+	// the worker and the backlog hold at most two, the rest find the queue
+	// full and are dead lettered
+	full := 0
+	for i := 0; i < 10; i++ {
+		if err := q.Forward(context.Background(), "charge.success", fmt.Sprint(i)); errors.Is(err, ErrForwardQueueFull) {
+			full++
+		}
+	}
+	if full < 8 {
+		t.Fatalf("%d forwards found the queue full, want at least 8", full)
+	}
+
+	dead := q.DeadLetters()
+	if len(dead) != 2 {
+		t.Fatalf("kept %d dead letters, want 2", len(dead))
+	}
+	if dead[1].Payload != "9" {
+		t.Errorf("newest dead letter is %v, want the last forward", dead[1].Payload)
+	}
+	if got := q.DeadLettersDropped(); got != int64(full-2) {
+		t.Errorf("dropped %d dead letters, want %d", got, full-2)
+	}
+
+	m := NewMetrics()
+	m.watchDeadLetters(q)
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if want := fmt.Sprintf("forward_dead_letters_dropped_total %d\n", full-2); !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("metrics don't report %q:\n%s", want, rec.Body)
+	}
+}
+
+func TestNilForwardQueueHasNoDeadLetters(t *testing.T) {
+	var q *ForwardQueue
+	if len(q.DeadLetters()) != 0 || q.DeadLettersDropped() != 0 {
+		t.Error("a nil queue reported dead letters")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// golang.org/x/time/rate isn't in our deps, this is a plain token bucket per
+// client which is all the limiter needs
+
+// bucket holds the tokens left for one client as of last
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter hands every client a bucket of burst tokens refilled at rate
+// per second, buckets nobody used for a while are dropped
+type RateLimiter struct {
+	mu        sync.Mutex
+	clock     Clock
+	rate      float64
+	burst     float64
+	idle      time.Duration
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewRateLimiter(clock Clock, rate float64, burst int) *RateLimiter {
+	// a bucket that has been idle long enough to refill completely is no
+	// different from a fresh one, so it can go
+	idle := time.Duration(float64(burst) / rate * float64(time.Second))
+
+	return &RateLimiter{
+		clock:     clock,
+		rate:      rate,
+		burst:     float64(burst),
+		idle:      max(idle, time.Minute),
+		buckets:   make(map[string]*bucket),
+		lastSweep: clock.Now(),
+	}
+}
+
+// allow takes a token from key's bucket, when it's empty it reports how long
+// until the next token is due
+func (rl *RateLimiter) allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.clock.Now()
+	rl.sweep(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops idle buckets, at most once per idle period
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.idle {
+		return
+	}
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) > rl.idle {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// RateLimit answers clients that ran out of tokens with a 429 and a
+// Retry-After telling them when to come back, a nil limiter lets everything
+// through
+func RateLimit(l *slog.Logger, rl *RateLimiter, trust ProxyTrust) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rl == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r, trust).String()
+
+			if ok, wait := rl.allow(ip); !ok {
+				l.Info("rate limited request", "source ip", ip, "retry after", wait)
+				w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+				writeError(w, l, APIError{Code: http.StatusTooManyRequests, Message: "too many requests"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
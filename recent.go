@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// RecentEvent is a verified webhook as it shows up on /debug/recent
+type RecentEvent struct {
+	RequestID  string          `json:"request_id"`
+	Provider   string          `json:"provider"`
+	Event      string          `json:"event"`
+	Status     int             `json:"status"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// RecentEvents is a fixed size ring buffer of the latest webhooks, enough to
+// see what came in without a database
+type RecentEvents struct {
+	mu     sync.Mutex
+	events []RecentEvent
+	next   int
+	full   bool
+}
+
+func NewRecentEvents(size int) *RecentEvents {
+	return &RecentEvents{events: make([]RecentEvent, size)}
+}
+
+// Add records e, pushing out the oldest event once the buffer is full
+func (r *RecentEvents) Add(e RecentEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Last returns up to n events, newest first
+func (r *RecentEvents) Last(n int) []RecentEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := r.next
+	if r.full {
+		count = len(r.events)
+	}
+	n = min(n, count)
+
+	out := make([]RecentEvent, n)
+	for i := range out {
+		out[i] = r.events[(r.next-1-i+len(r.events))%len(r.events)]
+	}
+
+	return out
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// redactedValue replaces whatever sat at a redacted path
+const redactedValue = "[REDACTED]"
+
+// defaultRedactPaths are the payload fields that hold customer PII or card
+// details, they never make it into the logs. paystack puts the customer and
+// card under data, stripe sends the object the event is about as
+// data.object and the fields it changed as data.previous_attributes. the
+// stripe paths cover charges, payment intents, checkout sessions, invoices
+// and customers
+var defaultRedactPaths = []string{
+	"data.customer.email",
+	"data.customer.first_name",
+	"data.customer.last_name",
+	"data.customer.phone",
+	"data.authorization",
+	"data.metadata",
+
+	"data.object.email",
+	"data.object.name",
+	"data.object.phone",
+	"data.object.address",
+	"data.object.shipping",
+	"data.object.shipping_details",
+	"data.object.billing_details",
+	"data.object.receipt_email",
+	"data.object.payment_method_details",
+	"data.object.customer_email",
+	"data.object.customer_name",
+	"data.object.customer_phone",
+	"data.object.customer_address",
+	"data.object.customer_shipping",
+	"data.object.customer_details",
+	"data.object.metadata",
+	"data.previous_attributes",
+}
+
+// redactJSON masks the value at every dot separated path in raw, objects are
+// masked whole. a path running into an array applies to each element, so
+// data.line_items.name masks every line item's name. raw that isn't JSON is
+// masked entirely since there's no telling what it holds
+func redactJSON(raw []byte, paths []string) []byte {
+	var doc any
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber() // keeps amounts exactly as they were sent
+	if err := dec.Decode(&doc); err != nil {
+		out, _ := json.Marshal(redactedValue)
+		return out
+	}
+
+	for _, path := range paths {
+		if path = strings.TrimSpace(path); path != "" {
+			redactPath(doc, strings.Split(path, "."))
+		}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		out, _ = json.Marshal(redactedValue)
+	}
+
+	return out
+}
+
+// redactForm redacts a form encoded body field by field and returns it as a
+// JSON object of the fields. a field named by one of paths is masked, a
+// field holding a JSON object or array (like the legacy provider's
+// payload) is run through redactJSON, anything else is kept. a field sent
+// more than once becomes an array
+func redactForm(raw []byte, paths []string) []byte {
+	form, err := url.ParseQuery(string(raw))
+	if err != nil {
+		out, _ := json.Marshal(redactedValue)
+		return out
+	}
+
+	fields := make(map[string]any, len(form))
+	for name, values := range form {
+		redacted := make([]any, len(values))
+		for i, v := range values {
+			switch trimmed := strings.TrimSpace(v); {
+			case slices.ContainsFunc(paths, func(p string) bool { return strings.TrimSpace(p) == name }):
+				redacted[i] = redactedValue
+			case strings.HasPrefix(trimmed, "{"), strings.HasPrefix(trimmed, "["):
+				redacted[i] = json.RawMessage(redactJSON([]byte(v), paths))
+			default:
+				redacted[i] = v
+			}
+		}
+
+		if len(redacted) == 1 {
+			fields[name] = redacted[0]
+		} else {
+			fields[name] = redacted
+		}
+	}
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		out, _ = json.Marshal(redactedValue)
+	}
+
+	return out
+}
+
+func redactPath(node any, path []string) {
+	switch node := node.(type) {
+	case map[string]any:
+		value, ok := node[path[0]]
+		if !ok {
+			return
+		}
+
+		if len(path) == 1 {
+			node[path[0]] = redactedValue
+			return
+		}
+
+		redactPath(value, path[1:])
+	case []any:
+		for _, item := range node {
+			redactPath(item, path)
+		}
+	}
+}
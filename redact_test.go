@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDefaultRedactPathsStripe(t *testing.T) {
+	raw := []byte(`{
+		"id": "evt_1",
+		"type": "charge.succeeded",
+		"data": {
+			"object": {
+				"id": "ch_1",
+				"amount": 2000,
+				"currency": "usd",
+				"customer": "cus_1",
+				"receipt_email": "jo@example.com",
+				"billing_details": {"email": "jo@example.com", "name": "Jo Doe", "address": {"line1": "1 Main St"}},
+				"payment_method_details": {"card": {"last4": "4242", "exp_month": 8}},
+				"shipping": {"name": "Jo Doe", "address": {"line1": "1 Main St"}},
+				"metadata": {"order_id": "1234"}
+			},
+			"previous_attributes": {"receipt_email": "old@example.com"}
+		}
+	}`)
+
+	out := string(redactJSON(raw, defaultRedactPaths))
+
+	for _, leak := range []string{"jo@example.com", "old@example.com", "Jo Doe", "1 Main St", "4242", "order_id"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("%q made it through: %s", leak, out)
+		}
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID       string      `json:"id"`
+				Amount   json.Number `json:"amount"`
+				Customer string      `json:"customer"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(out), &event); err != nil {
+		t.Fatalf("decoding redacted event: %v", err)
+	}
+	if event.Type != "charge.succeeded" || event.Data.Object.ID != "ch_1" || event.Data.Object.Amount != "2000" || event.Data.Object.Customer != "cus_1" {
+		t.Errorf("fields that aren't PII were lost: %s", out)
+	}
+}
+
+func TestDefaultRedactPathsPaystack(t *testing.T) {
+	out := string(redactJSON(loadFixtures(t)["charge.success"], defaultRedactPaths))
+
+	for _, leak := range []string{"jo@example.com", `"first_name":"Jo"`, "order_id", "authorization_code"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("%q made it through: %s", leak, out)
+		}
+	}
+	if !strings.Contains(out, `"reference":"qTPrJoy9Bx"`) {
+		t.Errorf("reference was lost: %s", out)
+	}
+}
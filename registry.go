@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	// ErrHandlerExists is returned when registering an event that already
+	// has a handler we ship with
+	ErrHandlerExists = errors.New("event already has a built-in handler")
+	// ErrHandlerNotFound is returned when removing an event that wasn't
+	// registered at runtime
+	ErrHandlerNotFound = errors.New("no runtime handler for event")
+)
+
+// HandlerSpec describes a handler registered at runtime, matching events are
+// relayed to ForwardURL as they came in, or as Template renders them when
+// one is given
+type HandlerSpec struct {
+	Event      string `json:"event"`
+	ForwardURL string `json:"forwardURL"`
+	// Template is a text/template run against the decoded payload, it has
+	// to render JSON. {{json .data.reference}} quotes a value
+	Template string `json:"template,omitempty"`
+}
+
+// templateFuncs are available to every HandlerSpec template
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseTemplate returns nil when the spec has no template. a key the
+// payload doesn't have fails the render rather than printing <no value>
+func (s HandlerSpec) parseTemplate() (*template.Template, error) {
+	if s.Template == "" {
+		return nil, nil
+	}
+
+	return template.New(s.Event).Funcs(templateFuncs).Option("missingkey=error").Parse(s.Template)
+}
+
+func (s HandlerSpec) Validate() error {
+	var v validator
+	v.check(s.Event != "", "event", "is required")
+
+	u, err := url.Parse(s.ForwardURL)
+	switch {
+	case s.ForwardURL == "":
+		v.check(false, "forwardURL", "is required")
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		v.check(false, "forwardURL", "must be an absolute http(s) URL")
+	}
+
+	if _, err := s.parseTemplate(); err != nil {
+		v.check(false, "template", err.Error())
+	}
+
+	return v.err("handler spec")
+}
+
+// HandlerRegistry keeps the handlers registered at runtime on top of the
+// router. they only live as long as the process, and never replace the
+// handlers we ship with
+type HandlerRegistry struct {
+	l       *slog.Logger
+	router  *EventRouter
+	retries int
+	timeout time.Duration
+
+	mu    sync.Mutex
+	specs map[string]HandlerSpec
+}
+
+// NewHandlerRegistry registers into router, forwards are retried and timed
+// out like FORWARD_URL ones
+func NewHandlerRegistry(l *slog.Logger, router *EventRouter, retries int, timeout time.Duration) *HandlerRegistry {
+	return &HandlerRegistry{l: l, router: router, retries: retries, timeout: timeout, specs: make(map[string]HandlerSpec)}
+}
+
+// Register routes spec.Event to a handler forwarding to spec.ForwardURL,
+// replacing an earlier runtime handler for the same event
+func (hr *HandlerRegistry) Register(spec HandlerSpec) error {
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	if _, builtIn := hr.router.Lookup(spec.Event); builtIn {
+		if _, ours := hr.specs[spec.Event]; !ours {
+			return fmt.Errorf("%w: %s", ErrHandlerExists, spec.Event)
+		}
+	}
+
+	// Validate already parsed it once, so this can't fail
+	tmpl, _ := spec.parseTemplate()
+	fwd := NewHTTPForwarder(hr.l, spec.ForwardURL, hr.retries, hr.timeout)
+	hr.router.Register(spec.Event, forwardRaw(hr.l, spec.Event, tmpl, fwd))
+	hr.specs[spec.Event] = spec
+
+	return nil
+}
+
+// Remove drops the runtime handler for event
+func (hr *HandlerRegistry) Remove(event string) error {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	if _, ok := hr.specs[event]; !ok {
+		return fmt.Errorf("%w: %s", ErrHandlerNotFound, event)
+	}
+
+	hr.router.Unregister(event)
+	delete(hr.specs, event)
+
+	return nil
+}
+
+// List returns the runtime handlers sorted by event
+func (hr *HandlerRegistry) List() []HandlerSpec {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	specs := make([]HandlerSpec, 0, len(hr.specs))
+	for _, spec := range hr.specs {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Event < specs[j].Event })
+
+	return specs
+}
+
+// forwardRaw relays the payload, untouched or run through tmpl when it's
+// not nil, we know nothing about the shape of events registered at runtime.
+// the forward is made while the sender waits, the failure policy decides
+// whether it hears about a failure
+func forwardRaw(l *slog.Logger, event string, tmpl *template.Template, fwd Forwarder) EventHandler {
+	return func(ctx context.Context, raw json.RawMessage) (HandlerResult, error) {
+		if tmpl != nil {
+			var err error
+			if raw, err = renderTemplate(tmpl, raw); err != nil {
+				l.Info("error rendering forward template", "event", event, "error context", err)
+				return HandlerResult{}, err
+			}
+		}
+
+		// a dry run shows what would have been sent instead of sending it
+		if isDryRun(ctx) {
+			return handled(raw), nil
+		}
+
+		if err := fwd.Forward(ctx, event, raw); err != nil {
+			l.Error("error forwarding runtime event", "event", event, "error context", err)
+			return HandlerResult{}, &ForwardError{Event: event, Result: handled(map[string]string{"status": "accepted", "event": event}), Err: err}
+		}
+
+		l.Info("forwarded runtime event", "event", event)
+		return handled(map[string]string{"status": "forwarded", "event": event}), nil
+	}
+}
+
+// renderTemplate runs tmpl against the decoded payload. a payload missing
+// what the template asks for is the sender's problem, a template that
+// doesn't render JSON is whoever registered it's
+func renderTemplate(tmpl *template.Template, raw json.RawMessage) (json.RawMessage, error) {
+	// numbers stay json.Number so ids don't come out as floats
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var data any
+	if err := dec.Decode(&data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	if !json.Valid(out.Bytes()) {
+		return nil, errors.New("template did not render valid JSON")
+	}
+
+	return out.Bytes(), nil
+}
+
+// ManageHandlers serves /admin/handlers: GET lists the runtime handlers and
+// POST registers one. DELETE /admin/handlers/{event} removes one
+func ManageHandlers(l *slog.Logger, registry *HandlerRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := l.With("request_id", requestIDFromContext(r.Context()))
+
+		if event, ok := strings.CutPrefix(r.URL.Path, "/admin/handlers/"); ok {
+			if r.Method != http.MethodDelete {
+				w.Header().Set("Allow", http.MethodDelete)
+				writeError(w, l, APIError{Code: http.StatusMethodNotAllowed, Message: "method not allowed"})
+				return
+			}
+
+			if err := registry.Remove(event); err != nil {
+				writeError(w, l, APIError{Code: http.StatusNotFound, Message: "no runtime handler for event", Details: map[string]string{"event": event}})
+				return
+			}
+
+			l.Info("removed runtime handler", "event", event)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, l, http.StatusOK, registry.List())
+		case http.MethodPost:
+			var spec HandlerSpec
+			if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+				writeError(w, l, APIError{Code: http.StatusBadRequest, Message: "invalid handler spec"})
+				return
+			}
+
+			if err := registry.Register(spec); err != nil {
+				var validationErr *ValidationError
+				switch {
+				case errors.As(err, &validationErr):
+					writeError(w, l, APIError{Code: http.StatusUnprocessableEntity, Message: "invalid handler spec", Details: validationErr.Fields})
+				case errors.Is(err, ErrHandlerExists):
+					writeError(w, l, APIError{Code: http.StatusConflict, Message: "event already has a built-in handler", Details: map[string]string{"event": spec.Event}})
+				default:
+					l.Error("error registering runtime handler", "error context", err)
+					writeError(w, l, APIError{Code: http.StatusInternalServerError, Message: "error registering handler"})
+				}
+				return
+			}
+
+			l.Info("registered runtime handler", "event", spec.Event, "forward url", spec.ForwardURL)
+			writeJSON(w, l, http.StatusCreated, spec)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, l, APIError{Code: http.StatusMethodNotAllowed, Message: "method not allowed"})
+		}
+	}
+}
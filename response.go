@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// APIError is the body every error response is sent with, so callers always
+// get the same envelope whatever went wrong
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"error"`
+	Details any    `json:"details,omitempty"`
+}
+
+func (e APIError) Error() string {
+	return e.Message
+}
+
+// writeError sends err as JSON with err.Code as the status
+func writeError(w http.ResponseWriter, l *slog.Logger, err APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Code)
+
+	enc := json.NewEncoder(w)
+	if wantsPrettyJSON(w) {
+		enc.SetIndent("", "  ")
+	}
+	if encodeErr := enc.Encode(err); encodeErr != nil {
+		logWriteError(l, "error encoding error response", encodeErr)
+	}
+}
+
+// writeJSON sends payload as JSON with the given status. the payload is
+// marshalled up front so an encoding failure can still go out as a 500
+func writeJSON(w http.ResponseWriter, l *slog.Logger, status int, payload any) {
+	var (
+		body []byte
+		err  error
+	)
+	if wantsPrettyJSON(w) {
+		body, err = json.MarshalIndent(payload, "", "  ")
+	} else {
+		body, err = json.Marshal(payload)
+	}
+	if err != nil {
+		l.Error("error encoding data to send as response", "error context", err)
+		writeError(w, l, APIError{Code: http.StatusInternalServerError, Message: "error encoding response"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		logWriteError(l, "error writing response", err)
+	}
+}
+
+// prettyWriter marks a response whose JSON should be indented, it's found
+// by unwrapping whatever other middleware put around it
+type prettyWriter struct {
+	http.ResponseWriter
+}
+
+func (pw prettyWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// PrettyJSON indents every JSON response when enabled, handy when reading
+// responses by hand but wasted bytes in production
+func PrettyJSON(enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(prettyWriter{w}, r)
+		})
+	}
+}
+
+// wantsPrettyJSON reports whether PrettyJSON is somewhere under w
+func wantsPrettyJSON(w http.ResponseWriter) bool {
+	for {
+		if _, ok := w.(prettyWriter); ok {
+			return true
+		}
+
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// logWriteError logs a failed response write, a client that hung up on us
+// is routine and only worth a debug line
+func logWriteError(l *slog.Logger, msg string, err error) {
+	if clientGone(err) {
+		l.Debug(msg+", client went away", "error context", err)
+		return
+	}
+
+	l.Error(msg, "error context", err)
+}
+
+// clientGone reports whether err means the connection was closed under us
+func clientGone(err error) bool {
+	return errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, context.Canceled)
+}
+
+// writeResult sends what an EventHandler asked for
+func writeResult(w http.ResponseWriter, l *slog.Logger, res HandlerResult) {
+	for k, v := range res.Headers {
+		w.Header().Set(k, v)
+	}
+
+	status := res.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	writeJSON(w, l, status, res.Body)
+}
+
+// prefersPlainText reports whether the Accept header ranks text/plain above
+// JSON. JSON wins ties, so a missing header or */* still gets JSON
+func prefersPlainText(accept string) bool {
+	textQ, jsonQ := acceptQuality(accept, "text/plain"), acceptQuality(accept, "application/json")
+	return textQ > jsonQ
+}
+
+// acceptQuality is the q value Accept gives mediaType, going by the most
+// specific range that matches it
+func acceptQuality(accept, mediaType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	best, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		s := -1
+		switch {
+		case mt == mediaType:
+			s = 2
+		case mt == typ+"/*":
+			s = 1
+		case mt == "*/*":
+			s = 0
+		}
+		if s < specificity || s < 0 {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		best, specificity = q, s
+	}
+
+	return best
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrInvalidPayload is wrapped by event handlers when the payload can't be
+// parsed, so the HTTP layer can answer with a 400 rather than a 500
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// EventHandler processes the raw payload of a single event type and returns
+// what should be sent back to the caller
+type EventHandler func(ctx context.Context, raw json.RawMessage) (HandlerResult, error)
+
+// HandlerResult is the response an EventHandler asks for, Body is sent as
+// JSON with Status (200 when unset) and Headers set on top
+type HandlerResult struct {
+	Status  int
+	Body    any
+	Headers map[string]string
+}
+
+// handled is the acknowledgement most handlers answer with
+func handled(body any) HandlerResult {
+	return HandlerResult{Status: ackPolicy(nil), Body: body}
+}
+
+// EventRouter maps an event name to the handler responsible for it, so adding
+// a new event is just a Register call instead of another switch case
+type EventRouter struct {
+	mu       sync.RWMutex
+	handlers map[string]EventHandler
+}
+
+func NewEventRouter() *EventRouter {
+	return &EventRouter{handlers: make(map[string]EventHandler)}
+}
+
+// Register sets the handler for an event, replacing any previous one
+func (er *EventRouter) Register(event string, handler EventHandler) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	er.handlers[event] = handler
+}
+
+// Lookup returns the handler registered for an event
+func (er *EventRouter) Lookup(event string) (EventHandler, bool) {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+
+	handler, ok := er.handlers[event]
+	return handler, ok
+}
+
+// Unregister removes the handler for an event, events without one are
+// ignored from then on
+func (er *EventRouter) Unregister(event string) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	delete(er.handlers, event)
+}
+
+// Events returns the events with a handler, sorted
+func (er *EventRouter) Events() []string {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+
+	events := make([]string, 0, len(er.handlers))
+	for event := range er.handlers {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	return events
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// EventSchema describes an event we handle, Required lists the dot separated
+// paths a payload has to carry for it to pass validation
+type EventSchema struct {
+	Event    string   `json:"event"`
+	Required []string `json:"required"`
+}
+
+// requiredFields runs the validator of event against an empty payload, what
+// it complains about is what a payload can't do without. events without a
+// typed payload, like the ones registered at runtime, only need their name
+func requiredFields(event string) []string {
+	required := []string{string(defaultEventNamePath)}
+
+	decode, ok := eventDecoders[event]
+	if !ok {
+		return required
+	}
+
+	ev, err := decode(json.RawMessage(`{}`))
+	if err != nil {
+		return required
+	}
+
+	var validationErr *ValidationError
+	if errors.As(ev.Validate(), &validationErr) {
+		for _, f := range validationErr.Fields {
+			required = append(required, f.Field)
+		}
+	}
+
+	return required
+}
+
+// Schema serves the events router has a handler for with their required
+// fields, it's built on every request so it follows runtime registrations
+func Schema(l *slog.Logger, router *EventRouter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		events := router.Events()
+
+		schema := make([]EventSchema, len(events))
+		for i, event := range events {
+			schema[i] = EventSchema{Event: event, Required: requiredFields(event)}
+		}
+
+		writeJSON(w, l, http.StatusOK, schema)
+	}
+}
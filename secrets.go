@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretProvider fetches a secret from wherever it's kept, the env and files
+// for now but a vault or parameter store client would slot in the same way
+type SecretProvider interface {
+	Secret(ctx context.Context) (string, error)
+}
+
+// StaticSecret is a secret that was handed over directly, e.g. from an env var
+type StaticSecret string
+
+func (s StaticSecret) Secret(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// FileSecret reads the secret from a file, like the ones docker and
+// kubernetes mount secrets as. surrounding whitespace is trimmed so a
+// trailing newline doesn't end up in the key
+type FileSecret struct {
+	Path string
+}
+
+func (f FileSecret) Secret(ctx context.Context) (string, error) {
+	b, err := os.ReadFile(f.Path)
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimSpace(string(b))
+	if secret == "" {
+		return "", errors.New("secret file is empty")
+	}
+
+	return secret, nil
+}
+
+// paystackSecretProvider picks where PAYSTACK_SECRET comes from, a
+// PAYSTACK_SECRET_FILE wins over the inline value
+func paystackSecretProvider() SecretProvider {
+	if path := os.Getenv("PAYSTACK_SECRET_FILE"); path != "" {
+		return FileSecret{Path: path}
+	}
+
+	return StaticSecret(os.Getenv("PAYSTACK_SECRET"))
+}
+
+// loadSecret is what loadEnv uses to resolve a secret, the env var is named
+// in the error so it's clear which one to fix
+func loadSecret(key string, p SecretProvider) (string, error) {
+	secret, err := p.Secret(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Server is the webhook service described by a Config, the public listener
+// plus the internal one when INTERNAL_ADDR is set
+type Server struct {
+	public   *http.Server
+	internal *http.Server
+	cfg      Config
+	l        *slog.Logger
+	// stop stops the background workers and closes what NewServer opened
+	stop func(context.Context) error
+}
+
+// Option changes how NewServer builds the server
+type Option func(*serverOptions)
+
+type serverOptions struct {
+	logger    *slog.Logger
+	store     EventStore
+	forwarder Forwarder
+	handlers  map[string]EventHandler
+}
+
+// WithLogger sets the logger, slog.Default() is used otherwise
+func WithLogger(l *slog.Logger) Option {
+	return func(o *serverOptions) { o.logger = l }
+}
+
+// WithStore stores events in s instead of the store DATABASE_URL describes,
+// s is left open when the server shuts down
+func WithStore(s EventStore) Option {
+	return func(o *serverOptions) { o.store = s }
+}
+
+// WithForwarder relays handled payments through f instead of the forwarder
+// FORWARD_URL describes. f is used as is, so queueing and retries are up to
+// it
+func WithForwarder(f Forwarder) Option {
+	return func(o *serverOptions) { o.forwarder = f }
+}
+
+// WithEventHandler registers h for event, on top of or in place of the
+// handlers the server comes with
+func WithEventHandler(event string, h EventHandler) Option {
+	return func(o *serverOptions) {
+		if o.handlers == nil {
+			o.handlers = map[string]EventHandler{}
+		}
+		o.handlers[event] = h
+	}
+}
+
+// NewServer builds the server described by cfg, opts replace the parts that
+// would otherwise come from cfg. settings cfg leaves at zero get the
+// defaults LoadConfig would have given them, and cfg has to pass Validate
+func NewServer(cfg Config, opts ...Option) (*Server, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	o := serverOptions{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var closeStore func() error
+	if o.store == nil {
+		store, err := openEventStore(context.Background(), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("opening event store: %w", err)
+		}
+		o.store = store
+
+		if closer, ok := store.(io.Closer); ok {
+			closeStore = closer.Close
+		}
+	}
+
+	public, internal, stopWorkers := newServer(cfg, o)
+
+	stop := func(ctx context.Context) error {
+		err := stopWorkers(ctx)
+		if err != nil {
+			err = fmt.Errorf("stopping background workers: %w", err)
+		}
+		if closeStore != nil {
+			err = errors.Join(err, closeStore())
+		}
+
+		return err
+	}
+
+	return &Server{public: public, internal: internal, cfg: cfg, l: o.logger, stop: stop}, nil
+}
+
+func (s *Server) servers() []*http.Server {
+	if s.internal == nil {
+		return []*http.Server{s.public}
+	}
+
+	return []*http.Server{s.public, s.internal}
+}
+
+// ListenAndServe starts every listener and blocks until they're all shut
+// down, or returns the first one that fails
+func (s *Server) ListenAndServe() error {
+	servers := s.servers()
+	errs := make(chan error, len(servers))
+
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			if s.cfg.TLSCertFile != "" {
+				// ListenAndServeTLS negotiates HTTP/2 on its own
+				s.l.Info("server listening", "addr", srv.Addr, "tls", true)
+				errs <- srv.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+				return
+			}
+
+			s.l.Info("server listening", "addr", srv.Addr, "tls", false)
+			errs <- srv.ListenAndServe()
+		}(srv)
+	}
+
+	for range servers {
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Shutdown drains the listeners, both at once and under the one deadline,
+// then stops the background workers. the workers are stopped even when the
+// listeners didn't drain in time, with whatever is left of ctx, so the
+// forward queue still reports what it dropped and the store is closed
+func (s *Server) Shutdown(ctx context.Context) error {
+	servers := s.servers()
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) { errs <- srv.Shutdown(ctx) }(srv)
+	}
+
+	var err error
+	for range servers {
+		err = errors.Join(err, <-errs)
+	}
+
+	return errors.Join(err, s.stop(ctx))
+}
+
+// newServer wires up the routes and builds the http.Server described by cfg,
+// plus the internal one serving the admin routes when cfg.InternalAddr is
+// set (nil otherwise). the returned func stops the background workers and
+// is called once the servers have shut down
+func newServer(cfg Config, o serverOptions) (*http.Server, *http.Server, func(context.Context) error) {
+	l, store := o.logger, o.store
+
+	deps := map[string]Pinger{}
+	if p, ok := store.(Pinger); ok {
+		deps["store"] = p
+	}
+
+	clock := realClock{}
+	metrics := NewMetrics()
+
+	// forwards go through the breaker so a downstream that's down isn't
+	// called for each event. batches are left out, they already make a
+	// single request per interval
+	withBreaker := func(f Forwarder) Forwarder {
+		if cfg.ForwardBreakerThreshold == 0 {
+			return f
+		}
+
+		breaker := NewCircuitBreaker(l, f, cfg.ForwardBreakerThreshold, cfg.ForwardBreakerCooldown, clock)
+		metrics.watchBreaker(breaker)
+		return breaker
+	}
+
+	// forwards go through the queue so the webhook doesn't wait on the
+	// downstream, the queue owns the retries so each http attempt is single
+	var (
+		fwd   Forwarder
+		queue *ForwardQueue
+		batch *BatchForwarder
+	)
+	switch {
+	case o.forwarder != nil:
+		fwd = o.forwarder
+		if p, ok := fwd.(Pinger); ok {
+			deps["forwarder"] = p
+		}
+	case cfg.ForwardURL != "" && cfg.ForwardFailurePolicy == ackOnSuccess:
+		// the sender has to hear whether the forward worked, so it's made
+		// while it waits and retried like a single request
+		httpForwarder := NewHTTPForwarder(l, cfg.ForwardURL, cfg.ForwardRetries, cfg.ForwardTimeout)
+		fwd, deps["forwarder"] = withBreaker(httpForwarder), httpForwarder
+	case cfg.ForwardURL != "" && cfg.ForwardBatchSize > 0:
+		// a batch is a single request, so it retries like one
+		httpForwarder := NewHTTPForwarder(l, cfg.ForwardURL, cfg.ForwardRetries, cfg.ForwardTimeout)
+		batch = NewBatchForwarder(l, httpForwarder, cfg.ForwardBatchSize, cfg.ForwardBatchInterval, cfg.ForwardQueueSize, cfg.DeadLetterSize)
+		metrics.watchBatch(batch)
+		fwd, deps["forwarder"] = batch, httpForwarder
+	case cfg.ForwardURL != "":
+		httpForwarder := NewHTTPForwarder(l, cfg.ForwardURL, 0, cfg.ForwardTimeout)
+		queue = NewForwardQueue(l, withBreaker(httpForwarder), cfg.ForwardWorkers, cfg.ForwardQueueSize, cfg.ForwardRetries, cfg.DeadLetterSize)
+		fwd, deps["forwarder"] = queue, httpForwarder
+	}
+
+	// a nil queue has no dead letters, which covers not forwarding at all
+	var deadLetterer DeadLetterer = queue
+	if batch != nil {
+		deadLetterer = batch
+	}
+	metrics.watchDeadLetters(deadLetterer)
+
+	router := newEventRouter(cfg, l, fwd)
+	for event, h := range o.handlers {
+		router.Register(event, h)
+	}
+
+	registry := NewHandlerRegistry(l, router, cfg.ForwardRetries, cfg.ForwardTimeout)
+
+	idempotency := NewMemoryIdempotencyStore(clock, cfg.IdempotencyTTL)
+	ageCheck := EventAgeCheck{MaxAge: cfg.MaxEventAge, Clock: clock}
+
+	var (
+		tracer   *Tracer
+		exporter *OTLPExporter
+	)
+	if cfg.OTLPEndpoint != "" {
+		exporter = NewOTLPExporter(l, cfg.OTLPEndpoint, cfg.ServiceName, 5*time.Second)
+		tracer = NewTracer(cfg.ServiceName, exporter)
+	}
+
+	recent := NewRecentEvents(cfg.RecentEventsSize)
+
+	// internal systems that want handled events subscribe here
+	dispatcher := NewDispatcher(l)
+
+	stats := NewDailyStats(clock)
+	dispatcher.Subscribe("stats", stats.Record)
+
+	var limiter *RateLimiter
+	if cfg.RateLimit > 0 {
+		limiter = NewRateLimiter(clock, cfg.RateLimit, cfg.RateBurst)
+	}
+
+	var capturer *Capturer
+	if cfg.DebugCapture != "" {
+		var err error
+		if capturer, err = NewCapturer(cfg.DebugCapture, cfg.DebugCaptureMaxFiles, cfg.RedactPaths, clock); err != nil {
+			l.Error("error setting up debug capture, carrying on without it", "error context", err)
+		} else {
+			l.Warn("debug capture is on, webhook requests and responses are being written to disk", "dir", cfg.DebugCapture)
+		}
+	}
+
+	proxyTrust := ProxyTrust{Proxies: cfg.TrustProxy, Peer: cfg.TrustForwardedFor}
+
+	// one limiter for every webhook route, so MAX_CONCURRENT_WEBHOOKS caps
+	// them all together
+	concurrency := LimitConcurrency(l, cfg.MaxConcurrentWebhooks)
+
+	// every webhook route gets the same guards, only the kind of body it
+	// takes differs
+	webhookChain := func(mediaType string) func(http.Handler) http.Handler {
+		return Chain(
+			AllowCIDRs(l, cfg.AllowedCIDRs, proxyTrust),
+			RateLimit(l, limiter, proxyTrust),
+			concurrency,
+			AllowMethods(l, http.MethodPost),
+			RequireContentType(l, mediaType),
+			LimitBody(l, cfg.MaxBodyBytes),
+			Decompress(l, cfg.MaxBodyBytes),
+			// last so the body it records is the decompressed one
+			Capture(l, capturer),
+		)
+	}
+	webhook := webhookChain("application/json")
+
+	providers := map[string]Provider{
+		"paystack": NewPaystackProvider(l, cfg.paystackKeys()...),
+	}
+	if cfg.StripeSecret != "" {
+		providers["stripe"] = NewStripeProvider(cfg.StripeSecret, clock)
+	}
+	if cfg.LegacySecret != "" {
+		providers["legacy"] = NewFormProvider(cfg.LegacySecret)
+	}
+
+	if cfg.AdminUser == "" {
+		l.Warn("ADMIN_USER and ADMIN_PASS are not set, admin routes will refuse every request")
+	}
+	admin := BasicAuth(l, cfg.AdminUser, cfg.AdminPass)
+
+	processor := NewWebhookProcessor(l, router, idempotency, store, ageCheck, dispatcher, clock, cfg.ForwardFailurePolicy)
+
+	// admin and metrics routes move to their own mux when they get their
+	// own listener, otherwise everything shares one
+	mux, internal := http.NewServeMux(), http.NewServeMux()
+	if cfg.InternalAddr == "" {
+		internal = mux
+	}
+
+	mux.Handle("/health", AllowMethods(l, http.MethodGet, http.MethodHead)(HealthCheck(l, clock, cfg.HealthStatus)))
+	mux.Handle("/version", AllowMethods(l, http.MethodGet, http.MethodHead)(VersionHandler(l)))
+	mux.Handle("/ready", AllowMethods(l, http.MethodGet, http.MethodHead)(ReadyCheck(l, deps)))
+	mux.Handle("/schema", AllowMethods(l, http.MethodGet, http.MethodHead)(Schema(l, router)))
+	mux.Handle("/dynamic-hook", webhook(HandleDynamicAPI(l, providers, processor, metrics, cfg.RedactPaths, clock, recent)))
+	mux.Handle("/dynamic-hook/", webhook(HandleDynamicAPI(l, providers, processor, metrics, cfg.RedactPaths, clock, recent)))
+	if _, ok := providers["legacy"]; ok {
+		// the one provider that posts forms, JSON senders never get here
+		mux.Handle("/dynamic-hook/legacy", webhookChain(formMediaType)(HandleDynamicAPI(l, providers, processor, metrics, cfg.RedactPaths, clock, recent)))
+	}
+	internal.Handle("/events", admin(AllowMethods(l, http.MethodGet)(ListEvents(l, store))))
+	internal.Handle("/events/", admin(AllowMethods(l, http.MethodPost)(ReplayEvent(l, router, store))))
+	internal.Handle("/metrics", metrics.Handler())
+	internal.Handle("/debug/recent", admin(AllowMethods(l, http.MethodGet)(ListRecentEvents(l, recent, cfg.RedactPaths))))
+	internal.Handle("/stats", admin(AllowMethods(l, http.MethodGet)(StatsHandler(l, stats))))
+	internal.Handle("/admin/handlers", admin(ManageHandlers(l, registry)))
+	internal.Handle("/admin/handlers/", admin(ManageHandlers(l, registry)))
+	internal.Handle("/deadletter", admin(AllowMethods(l, http.MethodGet)(ListDeadLetters(l, deadLetterer))))
+
+	// probes pointed at the internal port should work too
+	if internal != mux {
+		internal.Handle("/health", AllowMethods(l, http.MethodGet, http.MethodHead)(HealthCheck(l, clock, cfg.HealthStatus)))
+		internal.Handle("/ready", AllowMethods(l, http.MethodGet, http.MethodHead)(ReadyCheck(l, deps)))
+	}
+
+	// forwarders go first so the spans of their last deliveries get flushed
+	var closers []func(context.Context) error
+	if queue != nil {
+		closers = append(closers, queue.Close)
+	}
+	if batch != nil {
+		closers = append(closers, batch.Close)
+	}
+	if exporter != nil {
+		closers = append(closers, exporter.Close)
+	}
+
+	stop := func(ctx context.Context) error {
+		for _, closeFn := range closers {
+			if err := closeFn(ctx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	handler := Chain(PrettyJSON(cfg.PrettyJSON), Recover(l), RequestID, Trace(tracer), LogRequests(l), LimitHeaders(l, cfg.MaxHeaderCount), LimitRequestsPerConn(l, cfg.MaxRequestsPerConn), Timeout(cfg.RequestTimeout))
+
+	var internalSrv *http.Server
+	if internal != mux {
+		internalSrv = httpServer(cfg, cfg.InternalAddr, handler(withRoutePrefix(cfg.RoutePrefix, internal)))
+	}
+
+	return httpServer(cfg, cfg.Addr, handler(withRoutePrefix(cfg.RoutePrefix, mux))), internalSrv, stop
+}
+
+// withRoutePrefix mounts mux under prefix. routes are registered without
+// the prefix, stripping it up front keeps the path parsing in the handlers
+// oblivious to it
+func withRoutePrefix(prefix string, mux *http.ServeMux) http.Handler {
+	if prefix == "" {
+		return mux
+	}
+
+	prefixed := http.NewServeMux()
+	prefixed.Handle(prefix+"/", http.StripPrefix(prefix, mux))
+	return prefixed
+}
+
+// httpServer builds a server listening on addr with the limits and
+// timeouts from cfg
+func httpServer(cfg Config, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ConnContext:       countConnRequests,
+	}
+}
+
+// newEventRouter registers a handler for every event we act on, fwd may be
+// nil when nothing is relayed downstream
+func newEventRouter(cfg Config, l *slog.Logger, fwd Forwarder) *EventRouter {
+	router := NewEventRouter()
+	router.Register("paymentrequest.pending", HandlePaymentPending(l, cfg.AllowedCurrencies, cfg.StrictDecode))
+	router.Register("paymentrequest.success", HandlePaymentSuccessful(l, fwd, cfg.AllowedCurrencies, cfg.StrictDecode))
+	router.Register("paymentrequest.expired", HandlePaymentExpired(l, cfg.AllowedCurrencies, cfg.StrictDecode))
+	router.Register("charge.success", HandleChargeSuccess(l, fwd, cfg.AllowedCurrencies, cfg.StrictDecode))
+	router.Register("invoice.create", HandleInvoice(l, "invoice.create", cfg.AllowedCurrencies, cfg.StrictDecode))
+	router.Register("invoice.update", HandleInvoice(l, "invoice.update", cfg.AllowedCurrencies, cfg.StrictDecode))
+
+	return router
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewServerFillsDefaults(t *testing.T) {
+	srv, err := NewServer(Config{PaystackSecret: "s3cr3t"}, WithLogger(discardLogger()))
+	if err != nil {
+		t.Fatalf("building server: %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	rec := httptest.NewRecorder()
+	srv.public.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /health answered %d: %s", rec.Code, rec.Body)
+	}
+
+	body := loadFixtures(t)["charge.success"]
+	mac := hmac.New(sha512.New, []byte("s3cr3t"))
+	mac.Write(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/dynamic-hook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(paystackSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+
+	rec = httptest.NewRecorder()
+	srv.public.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("POST /dynamic-hook answered %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestNewServerValidates(t *testing.T) {
+	if _, err := NewServer(Config{}, WithLogger(discardLogger())); err == nil {
+		t.Error("built a server without a paystack secret")
+	}
+}
+
+func TestConfigWithDefaultsKeepsMeaningfulZeros(t *testing.T) {
+	cfg := Config{PaystackSecret: "s3cr3t", MaxBodyBytes: 512}.withDefaults()
+
+	if cfg.MaxBodyBytes != 512 {
+		t.Errorf("MaxBodyBytes %d, want the 512 that was set", cfg.MaxBodyBytes)
+	}
+	if cfg.MaxConcurrentWebhooks != defaultConfig().MaxConcurrentWebhooks || cfg.MemoryStoreSize != defaultConfig().MemoryStoreSize {
+		t.Errorf("zero limits weren't filled: %+v", cfg)
+	}
+	// zero is a setting of its own for these
+	if cfg.ForwardRetries != 0 || cfg.ForwardBreakerThreshold != 0 || cfg.RequestTimeout != 0 || cfg.LogMaxBackups != 0 {
+		t.Errorf("meaningful zeros were overwritten: %+v", cfg)
+	}
+}
+
+func TestShutdownStopsWorkersWhenDrainingFails(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := &http.Server{Handler: http.NotFoundHandler()}
+	go public.Serve(ln)
+
+	// half a request keeps the connection active, so draining can't finish
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /health HTTP/1.1\r\n")
+	time.Sleep(50 * time.Millisecond)
+
+	stopErr := errors.New("store close failed")
+	stopped := false
+	srv := &Server{public: public, stop: func(context.Context) error {
+		stopped = true
+		return stopErr
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = srv.Shutdown(ctx)
+	if !stopped {
+		t.Fatal("background workers weren't stopped")
+	}
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, stopErr) {
+		t.Errorf("got %v, want both the drain and the stop error", err)
+	}
+}
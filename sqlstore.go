@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// registers the "sqlite" driver, pure Go so the build needs no cgo
+	_ "modernc.org/sqlite"
+)
+
+// SQLEventStore keeps events in a SQL database, it is written against
+// SQLite but sticks to plain SQL.
+//
+// database/sql only ships the interface, the "sqlite" driver is linked in
+// above and any other driver named in DATABASE_DRIVER needs its own import
+type SQLEventStore struct {
+	db *sql.DB
+}
+
+// migrations run in order every time the store is opened, so each statement
+// has to be safe to repeat
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS events (
+		id              TEXT PRIMARY KEY,
+		event           TEXT NOT NULL,
+		raw             TEXT NOT NULL,
+		received_at     TEXT NOT NULL,
+		signature_valid BOOLEAN NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS events_event_received_at ON events (event, received_at)`,
+}
+
+// receivedAtLayout is fixed width so timestamps sort correctly as text
+const receivedAtLayout = "2006-01-02T15:04:05.000000000Z"
+
+// sqlitePragmas are set on every sqlite connection unless the DSN sets them
+// itself. a writer waits up to busy_timeout ms for the lock instead of
+// failing straight away with SQLITE_BUSY, and WAL lets reads carry on
+// while it writes
+var sqlitePragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)"}
+
+// NewSQLEventStore opens the database at dsn with the given driver and
+// makes sure the schema is in place
+func NewSQLEventStore(ctx context.Context, driver, dsn string) (*SQLEventStore, error) {
+	if driver == "sqlite" {
+		dsn = sqliteDSN(dsn)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s database: %w", driver, err)
+	}
+
+	// sqlite takes one writer at a time, queueing inserts in the pool is
+	// cheaper than having them race for the file lock
+	if driver == "sqlite" {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to %s database: %w", driver, err)
+	}
+
+	for _, migration := range migrations {
+		if _, err := db.ExecContext(ctx, migration); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("running migration: %w", err)
+		}
+	}
+
+	return &SQLEventStore{db: db}, nil
+}
+
+// sqliteDSN adds the sqlitePragmas the DSN doesn't already set
+func sqliteDSN(dsn string) string {
+	for _, pragma := range sqlitePragmas {
+		name, _, _ := strings.Cut(pragma, "(")
+		if strings.Contains(dsn, "_pragma="+name) {
+			continue
+		}
+
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_pragma=" + pragma
+	}
+
+	return dsn
+}
+
+func (s *SQLEventStore) Save(ctx context.Context, e StoredEvent) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO events (id, event, raw, received_at, signature_valid) VALUES (?, ?, ?, ?, ?)`,
+		e.ID, e.Event, string(e.Raw), e.ReceivedAt.UTC().Format(receivedAtLayout), e.SignatureValid,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting event %s: %w", e.ID, err)
+	}
+
+	return nil
+}
+
+func (s *SQLEventStore) Get(ctx context.Context, id string) (StoredEvent, error) {
+	var (
+		e          StoredEvent
+		raw        string
+		receivedAt string
+	)
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, event, raw, received_at, signature_valid FROM events WHERE id = ?`, id,
+	).Scan(&e.ID, &e.Event, &raw, &receivedAt, &e.SignatureValid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return StoredEvent{}, ErrEventNotFound
+	}
+	if err != nil {
+		return StoredEvent{}, fmt.Errorf("loading event %s: %w", id, err)
+	}
+
+	e.Raw = []byte(raw)
+	if e.ReceivedAt, err = time.Parse(receivedAtLayout, receivedAt); err != nil {
+		return StoredEvent{}, fmt.Errorf("parsing received_at of event %s: %w", id, err)
+	}
+
+	return e, nil
+}
+
+// List returns matching events oldest first
+func (s *SQLEventStore) List(ctx context.Context, filter Filter) ([]StoredEvent, error) {
+	var (
+		where []string
+		args  []any
+	)
+
+	if filter.Event != "" {
+		where = append(where, "event = ?")
+		args = append(args, filter.Event)
+	}
+
+	if !filter.Since.IsZero() {
+		where = append(where, "received_at >= ?")
+		args = append(args, filter.Since.UTC().Format(receivedAtLayout))
+	}
+
+	if !filter.Until.IsZero() {
+		where = append(where, "received_at <= ?")
+		args = append(args, filter.Until.UTC().Format(receivedAtLayout))
+	}
+
+	query := `SELECT id, event, raw, received_at, signature_valid FROM events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY received_at, id"
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []StoredEvent{}
+	for rows.Next() {
+		var (
+			e          StoredEvent
+			raw        string
+			receivedAt string
+		)
+
+		if err := rows.Scan(&e.ID, &e.Event, &raw, &receivedAt, &e.SignatureValid); err != nil {
+			return nil, fmt.Errorf("scanning event: %w", err)
+		}
+
+		e.Raw = []byte(raw)
+		if e.ReceivedAt, err = time.Parse(receivedAtLayout, receivedAt); err != nil {
+			return nil, fmt.Errorf("parsing received_at of event %s: %w", e.ID, err)
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (s *SQLEventStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLEventStore) Close() error {
+	return s.db.Close()
+}
+
+// openEventStore picks the SQL store when DATABASE_URL is set and falls back
+// to keeping the latest MEMORY_STORE_SIZE events in memory
+func openEventStore(ctx context.Context, cfg Config) (EventStore, error) {
+	if cfg.DatabaseURL == "" {
+		return NewMemoryEventStore(cfg.MemoryStoreSize), nil
+	}
+
+	return NewSQLEventStore(ctx, cfg.DatabaseDriver, cfg.DatabaseURL)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestSQLStore(t *testing.T, path string) *SQLEventStore {
+	t.Helper()
+
+	store, err := NewSQLEventStore(context.Background(), "sqlite", path)
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestSQLEventStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.db")
+	store := openTestSQLStore(t, path)
+
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	events := []StoredEvent{
+		{ID: "a", Event: "charge.success", Raw: json.RawMessage(`{"event":"charge.success"}`), ReceivedAt: base, SignatureValid: true},
+		{ID: "b", Event: "paymentrequest.pending", Raw: json.RawMessage(`{"event":"paymentrequest.pending"}`), ReceivedAt: base.Add(time.Minute), SignatureValid: true},
+		{ID: "c", Event: "charge.success", Raw: json.RawMessage(`{"event":"charge.success","n":2}`), ReceivedAt: base.Add(2 * time.Minute), SignatureValid: false},
+	}
+	for _, e := range events {
+		if err := store.Save(ctx, e); err != nil {
+			t.Fatalf("saving %s: %v", e.ID, err)
+		}
+	}
+
+	got, err := store.Get(ctx, "c")
+	if err != nil {
+		t.Fatalf("getting c: %v", err)
+	}
+	if got.Event != "charge.success" || string(got.Raw) != `{"event":"charge.success","n":2}` || !got.ReceivedAt.Equal(base.Add(2*time.Minute)) || got.SignatureValid {
+		t.Errorf("got %+v, want event c as saved", got)
+	}
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("getting a missing event: got %v, want ErrEventNotFound", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"everything oldest first", Filter{}, []string{"a", "b", "c"}},
+		{"by event", Filter{Event: "charge.success"}, []string{"a", "c"}},
+		{"since", Filter{Since: base.Add(time.Minute)}, []string{"b", "c"}},
+		{"until", Filter{Until: base.Add(time.Minute)}, []string{"a", "b"}},
+		{"limit", Filter{Limit: 1}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listed, err := store.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("listing: %v", err)
+			}
+
+			ids := make([]string, len(listed))
+			for i, e := range listed {
+				ids[i] = e.ID
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("got %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLEventStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.db")
+
+	first := openTestSQLStore(t, path)
+	if err := first.Save(ctx, StoredEvent{ID: "kept", Event: "charge.success", Raw: json.RawMessage(`{}`), ReceivedAt: time.Now()}); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+	first.Close()
+
+	// the migrations run again on open and must leave the data alone
+	second := openTestSQLStore(t, path)
+	if _, err := second.Get(ctx, "kept"); err != nil {
+		t.Fatalf("event saved before reopening: %v", err)
+	}
+}
+
+func TestSQLEventStoreConcurrentSaves(t *testing.T) {
+	ctx := context.Background()
+	store := openTestSQLStore(t, filepath.Join(t.TempDir(), "events.db"))
+
+	const saves = 200
+	errs := make(chan error, saves)
+	var wg sync.WaitGroup
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- store.Save(ctx, StoredEvent{ID: fmt.Sprint(i), Event: "charge.success", Raw: json.RawMessage(`{}`), ReceivedAt: time.Now()})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent save: %v", err)
+		}
+	}
+
+	events, err := store.List(ctx, Filter{})
+	if err != nil {
+		t.Fatalf("listing: %v", err)
+	}
+	if len(events) != saves {
+		t.Errorf("stored %d events, want %d", len(events), saves)
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"events.db", "events.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"},
+		{"file:events.db?cache=shared", "file:events.db?cache=shared&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"},
+		{"events.db?_pragma=busy_timeout(100)", "events.db?_pragma=busy_timeout(100)&_pragma=journal_mode(WAL)"},
+	}
+	for _, tt := range tests {
+		if got := sqliteDSN(tt.dsn); got != tt.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// statsEvents are the events that count towards the daily totals
+var statsEvents = map[string]bool{
+	"paymentrequest.success": true,
+	"charge.success":         true,
+}
+
+// CurrencyTotal is what was paid in one currency so far today
+type CurrencyTotal struct {
+	TotalMinor int64 `json:"total_minor"`
+	Count      int   `json:"count"`
+}
+
+// DailyStats keeps running totals of successful payments per currency. the
+// totals start over on the first payment of a new UTC day
+type DailyStats struct {
+	mu     sync.Mutex
+	clock  Clock
+	day    string
+	totals map[string]*CurrencyTotal
+}
+
+func NewDailyStats(clock Clock) *DailyStats {
+	return &DailyStats{clock: clock, totals: map[string]*CurrencyTotal{}}
+}
+
+// rollover resets the totals when the day changed since they were started
+func (s *DailyStats) rollover() {
+	today := s.clock.Now().UTC().Format("2006-01-02")
+	if today != s.day {
+		s.day, s.totals = today, map[string]*CurrencyTotal{}
+	}
+}
+
+// Record is a Subscriber, it adds successful payments to today's totals and
+// ignores everything else
+func (s *DailyStats) Record(ctx context.Context, ev NormalizedEvent) error {
+	if !statsEvents[ev.Type] {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rollover()
+
+	total, ok := s.totals[ev.Currency]
+	if !ok {
+		total = &CurrencyTotal{}
+		s.totals[ev.Currency] = total
+	}
+	total.TotalMinor += ev.AmountMinor
+	total.Count++
+
+	return nil
+}
+
+// DailyTotals is a snapshot of one day of payments, it is the /stats body
+type DailyTotals struct {
+	Date       string                   `json:"date"`
+	Currencies map[string]CurrencyTotal `json:"currencies"`
+}
+
+// Snapshot copies today's totals
+func (s *DailyStats) Snapshot() DailyTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rollover()
+
+	out := DailyTotals{Date: s.day, Currencies: make(map[string]CurrencyTotal, len(s.totals))}
+	for currency, total := range s.totals {
+		out.Currencies[currency] = *total
+	}
+
+	return out
+}
+
+// StatsHandler serves today's payment totals per currency
+func StatsHandler(l *slog.Logger, stats *DailyStats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, l, http.StatusOK, stats.Snapshot())
+	}
+}
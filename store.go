@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// StoredEvent is a received webhook as we keep it for audit and replay
+type StoredEvent struct {
+	ID             string          `json:"id"`
+	Event          string          `json:"event"`
+	Raw            json.RawMessage `json:"raw"`
+	ReceivedAt     time.Time       `json:"received_at"`
+	SignatureValid bool            `json:"signature_valid"`
+}
+
+// Filter narrows down a List call, zero values mean no restriction
+type Filter struct {
+	Event string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+func (f Filter) matches(e StoredEvent) bool {
+	if f.Event != "" && e.Event != f.Event {
+		return false
+	}
+
+	if !f.Since.IsZero() && e.ReceivedAt.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && e.ReceivedAt.After(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+// ErrEventNotFound is returned by Get when no event has the given ID
+var ErrEventNotFound = errors.New("event not found")
+
+// EventStore persists received webhooks
+type EventStore interface {
+	Save(ctx context.Context, e StoredEvent) error
+	Get(ctx context.Context, id string) (StoredEvent, error)
+	List(ctx context.Context, filter Filter) ([]StoredEvent, error)
+}
+
+// MemoryEventStore keeps the latest events in a slice, it is lost on restart
+type MemoryEventStore struct {
+	mu     sync.RWMutex
+	events []StoredEvent
+	max    int
+}
+
+// NewMemoryEventStore keeps at most max events, the oldest are dropped as
+// new ones come in so a long running process doesn't grow without bound
+func NewMemoryEventStore(max int) *MemoryEventStore {
+	return &MemoryEventStore{max: max}
+}
+
+func (s *MemoryEventStore) Save(ctx context.Context, e StoredEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, e)
+	if len(s.events) > s.max {
+		// let go of the raw body now, the backing array is only replaced
+		// the next time append grows it
+		s.events[0] = StoredEvent{}
+		s.events = s.events[1:]
+	}
+
+	return nil
+}
+
+func (s *MemoryEventStore) Get(ctx context.Context, id string) (StoredEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, e := range s.events {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+
+	return StoredEvent{}, ErrEventNotFound
+}
+
+// Ping always succeeds, there is nothing that can be down
+func (s *MemoryEventStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// List returns matching events oldest first
+func (s *MemoryEventStore) List(ctx context.Context, filter Filter) ([]StoredEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []StoredEvent{}
+	for _, e := range s.events {
+		if !filter.matches(e) {
+			continue
+		}
+
+		events = append(events, e)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMemoryEventStoreDropsOldest(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryEventStore(3)
+
+	for i := 1; i <= 5; i++ {
+		if err := store.Save(ctx, StoredEvent{ID: fmt.Sprint(i), Event: "charge.success"}); err != nil {
+			t.Fatalf("saving %d: %v", i, err)
+		}
+	}
+
+	events, err := store.List(ctx, Filter{})
+	if err != nil {
+		t.Fatalf("listing: %v", err)
+	}
+
+	var ids []string
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	if fmt.Sprint(ids) != "[3 4 5]" {
+		t.Errorf("kept %v, want [3 4 5]", ids)
+	}
+
+	if _, err := store.Get(ctx, "1"); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("getting a dropped event: got %v, want ErrEventNotFound", err)
+	}
+}
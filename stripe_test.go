@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stripeSignature is the v1 signature stripe sends for body at timestamp
+func stripeSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStripeProviderVerify(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	p := NewStripeProvider("whsec_test", newFakeClock(now))
+	body := []byte(`{"type":"charge.succeeded"}`)
+
+	header := func(signedAt time.Time, secrets ...string) string {
+		h := fmt.Sprintf("t=%d", signedAt.Unix())
+		for _, secret := range secrets {
+			h += ",v1=" + stripeSignature(secret, signedAt.Unix(), body)
+		}
+		return h
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   error
+	}{
+		{"signed now", header(now, "whsec_test"), nil},
+		{"signed within tolerance", header(now.Add(-stripeTolerance), "whsec_test"), nil},
+		{"signed too long ago", header(now.Add(-stripeTolerance-time.Second), "whsec_test"), ErrInvalidSignature},
+		{"signed in the future", header(now.Add(stripeTolerance+time.Second), "whsec_test"), ErrInvalidSignature},
+		{"wrong secret", header(now, "whsec_other"), ErrInvalidSignature},
+		{"secret being rolled", header(now, "whsec_other", "whsec_test"), nil},
+		{"no signature", header(now), ErrInvalidSignature},
+		{"no header", "", ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/dynamic-hook", nil)
+			if tt.header != "" {
+				r.Header.Set(stripeSignatureHeader, tt.header)
+			}
+
+			err := p.Verify(r, body)
+			if (err == nil) != (tt.want == nil) || !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the otel sdk isn't in our deps, so this is the small slice of it we need:
+// spans with W3C trace context propagation, handed to a SpanExporter when
+// they end. with no tracer configured every span is nil and does nothing
+
+// traceparentHeader carries the W3C trace context, 00-{trace id}-{span id}-{flags}
+const traceparentHeader = "traceparent"
+
+// SpanExporter receives every span once it has ended
+type SpanExporter interface {
+	ExportSpan(s *Span)
+}
+
+// Tracer starts spans and hands them to its exporter when they end
+type Tracer struct {
+	service  string
+	exporter SpanExporter
+}
+
+func NewTracer(service string, exporter SpanExporter) *Tracer {
+	return &Tracer{service: service, exporter: exporter}
+}
+
+// Span is one timed operation, its methods are safe to call on a nil span
+// so call sites don't need to care whether tracing is on
+type Span struct {
+	tracer   *Tracer
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte
+	Name     string
+	Server   bool
+	StartAt  time.Time
+	EndAt    time.Time
+
+	mu    sync.Mutex
+	Attrs map[string]string
+	Err   error
+	ended bool
+}
+
+type spanKey struct{}
+
+// Start begins a span named name, a child of the span in ctx when there is
+// one. a nil tracer returns ctx unchanged and a nil span
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &Span{tracer: t, Name: name, StartAt: time.Now(), Attrs: map[string]string{}}
+	if parent := spanFromContext(ctx); parent != nil {
+		s.TraceID, s.ParentID = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	rand.Read(s.SpanID[:])
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// startSpan begins a child of the span in ctx with the tracer that started
+// it, so code deep in the call stack doesn't need a tracer of its own
+func startSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := spanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	return parent.tracer.Start(ctx, name)
+}
+
+func spanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// withSpan puts s in ctx, used to carry a span over to work that outlives
+// the request it started in
+func withSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Attrs[key] = value
+}
+
+// RecordError marks the span as failed, nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Err = err
+}
+
+// End stamps the end time and exports the span, only the first call counts
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.EndAt = true, time.Now()
+	s.mu.Unlock()
+
+	s.tracer.exporter.ExportSpan(s)
+}
+
+// traceparent renders the span as a W3C traceparent header value
+func (s *Span) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.TraceID[:]), hex.EncodeToString(s.SpanID[:]))
+}
+
+// parseTraceparent reads the trace and parent span ids out of a traceparent
+// header, anything malformed is treated as no incoming trace
+func parseTraceparent(header string) (traceID [16]byte, spanID [8]byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || parts[0] == "ff" {
+		return traceID, spanID, false
+	}
+
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, spanID, false
+	}
+
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil || spanID == [8]byte{} {
+		return traceID, spanID, false
+	}
+
+	return traceID, spanID, true
+}
+
+// Trace starts a server span for every request, continuing the caller's
+// trace when it sent a traceparent header. a nil tracer turns it off
+func Trace(t *Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if t == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			// the remote parent only needs ids, it never ends or gets exported
+			if traceID, spanID, ok := parseTraceparent(r.Header.Get(traceparentHeader)); ok {
+				ctx = withSpan(ctx, &Span{tracer: t, TraceID: traceID, SpanID: spanID})
+			}
+
+			ctx, span := t.Start(ctx, r.Method+" "+r.URL.Path)
+			span.Server = true
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.target", r.URL.Path)
+			span.SetAttribute("request.id", requestIDFromContext(ctx))
+			defer span.End()
+
+			rec := newStatusRecorder(w)
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			span.SetAttribute("http.status_code", fmt.Sprint(rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.RecordError(fmt.Errorf("responded with %d", rec.status))
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NullTime is a timestamp the payload may send as null or as an empty
+// string, either way Valid is false and Time is the zero value
+type NullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (nt *NullTime) UnmarshalJSON(b []byte) error {
+	*nt = NullTime{}
+
+	if string(b) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("timestamp must be a string or null, got %s", b)
+	}
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return fmt.Errorf("timestamp %q is not RFC3339: %w", s, err)
+	}
+
+	nt.Time, nt.Valid = t, true
+	return nil
+}
+
+func (nt NullTime) MarshalJSON() ([]byte, error) {
+	if !nt.Valid {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(nt.Time)
+}
+
+// NullString is a value the payload may send as null, a string or a number,
+// numbers are kept in their JSON text form so nothing is lost
+type NullString struct {
+	String string
+	Valid  bool
+}
+
+func (ns *NullString) UnmarshalJSON(b []byte) error {
+	*ns = NullString{}
+
+	if string(b) == "null" {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, &ns.String); err == nil {
+		ns.Valid = true
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("value must be a string, number or null, got %s", b)
+	}
+
+	ns.String, ns.Valid = n.String(), true
+	return nil
+}
+
+func (ns NullString) MarshalJSON() ([]byte, error) {
+	if !ns.Valid {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(ns.String)
+}
+
+// Customer is the payer on a payment request. paystack sends either just the
+// customer id or the customer object, both end up here
+type Customer struct {
+	ID    int    `json:"id"`
+	Code  string `json:"customer_code,omitempty"`
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+func (c *Customer) UnmarshalJSON(b []byte) error {
+	*c = Customer{}
+
+	if string(b) == "null" {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, &c.ID); err == nil {
+		return nil
+	}
+
+	var obj struct {
+		ID           int    `json:"id"`
+		CustomerCode string `json:"customer_code"`
+		Email        string `json:"email"`
+		Name         string `json:"name"`
+		FirstName    string `json:"first_name"`
+		LastName     string `json:"last_name"`
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return fmt.Errorf("customer must be an id, an object or null, got %s", b)
+	}
+
+	name := obj.Name
+	if name == "" {
+		name = strings.TrimSpace(obj.FirstName + " " + obj.LastName)
+	}
+
+	*c = Customer{ID: obj.ID, Code: obj.CustomerCode, Email: obj.Email, Name: name}
+	return nil
+}
+
+// Amount is a minor unit amount. it is decoded from the JSON number text
+// rather than through float64, so large values keep every digit, whole
+// numbers in float or exponent form like 1.0e3 are accepted and anything
+// that doesn't fit an int64 is an error instead of silently wrapping
+type Amount int64
+
+// maxAmountExponent bounds the exponent an amount may be written with, an
+// int64 has 19 digits so this leaves room for trailing zero fractions
+const maxAmountExponent = 64
+
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("amount must be a number, got %s", b)
+	}
+
+	if v, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		*a = Amount(v)
+		return nil
+	}
+
+	// big.Rat takes exponents up to a million digits and expanding one of
+	// those is slow, nothing with an exponent this big is a sane amount
+	if _, exp, ok := strings.Cut(strings.ToLower(n.String()), "e"); ok {
+		if e, err := strconv.Atoi(exp); err != nil || e < -maxAmountExponent || e > maxAmountExponent {
+			return fmt.Errorf("amount %s is out of range", n)
+		}
+	}
+
+	r, ok := new(big.Rat).SetString(n.String())
+	if !ok {
+		return fmt.Errorf("amount %s is not a valid number", n)
+	}
+
+	if !r.IsInt() {
+		return fmt.Errorf("amount %s is not a whole number of minor units", n)
+	}
+
+	if !r.Num().IsInt64() {
+		return fmt.Errorf("amount %s overflows a 64 bit integer", n)
+	}
+
+	*a = Amount(r.Num().Int64())
+	return nil
+}
+
+// Metadata is the free form metadata object merchants attach to payments,
+// values are kept raw since every merchant puts something different in it.
+// paystack sends "0", "" or 0 instead of an object when there's none, those
+// decode to an empty Metadata, and an object sent as a JSON string is
+// unwrapped
+type Metadata map[string]json.RawMessage
+
+func (m *Metadata) UnmarshalJSON(b []byte) error {
+	*m = nil
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err == nil {
+		*m = obj
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		if json.Unmarshal([]byte(s), &obj) == nil {
+			*m = obj
+		}
+		return nil
+	}
+
+	// anything else (numbers, arrays) carries nothing we can look up
+	if !json.Valid(b) {
+		return fmt.Errorf("metadata must be an object, got %s", b)
+	}
+
+	return nil
+}
+
+// MetadataString returns the value under key when it's a string or a
+// number, numbers come back in their JSON text form
+func (m Metadata) MetadataString(key string) (string, bool) {
+	raw, ok := m[key]
+	if !ok {
+		return "", false
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String(), true
+	}
+
+	return "", false
+}
+
+// PaymentStatus is the status of a payment, charge or invoice
+type PaymentStatus string
+
+const (
+	StatusPending   PaymentStatus = "pending"
+	StatusSuccess   PaymentStatus = "success"
+	StatusFailed    PaymentStatus = "failed"
+	StatusExpired   PaymentStatus = "expired"
+	StatusAbandoned PaymentStatus = "abandoned"
+	StatusReversed  PaymentStatus = "reversed"
+)
+
+var knownPaymentStatuses = map[PaymentStatus]bool{
+	StatusPending:   true,
+	StatusSuccess:   true,
+	StatusFailed:    true,
+	StatusExpired:   true,
+	StatusAbandoned: true,
+	StatusReversed:  true,
+}
+
+// Known reports whether s is one of the statuses above
+func (s PaymentStatus) Known() bool {
+	return knownPaymentStatuses[s]
+}
+
+// UnmarshalJSON maps the known statuses whatever their case, anything else
+// is kept as sent so validation can report it
+func (s *PaymentStatus) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("status must be a string, got %s", b)
+	}
+
+	*s = PaymentStatus(v)
+	if known := PaymentStatus(strings.ToLower(strings.TrimSpace(v))); known.Known() {
+		*s = known
+	}
+
+	return nil
+}
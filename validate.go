@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// runValidate is the validate subcommand, it dry runs a captured payload
+// through the same processing a delivery gets and prints the normalized
+// event or what's wrong with it. signatures and the age check are skipped
+// since captured payloads are neither signed nor fresh. the return value is
+// the exit code
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: handling-dynamic-api validate path/to/payload.json")
+		return 2
+	}
+
+	// only the settings that change how payloads are decoded matter here,
+	// so a missing secret isn't an error
+	cfg, err := loadEnv()
+	if err != nil {
+		fmt.Fprintln(stderr, "invalid configuration:", err)
+		return 1
+	}
+
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, "error reading payload:", err)
+		return 1
+	}
+
+	l := newLogger(cfg.LogFormat, slog.LevelWarn, stderr)
+	clock := realClock{}
+	processor := NewWebhookProcessor(l, newEventRouter(cfg, l, nil), NewMemoryIdempotencyStore(clock, cfg.IdempotencyTTL), NewMemoryEventStore(cfg.MemoryStoreSize), EventAgeCheck{}, NewDispatcher(l), clock, ackAlways)
+
+	res, err := processor.ProcessWebhook(withDryRun(context.Background()), raw)
+	if err != nil {
+		var validationErr *ValidationError
+		var apiErr APIError
+		switch {
+		case errors.As(err, &validationErr):
+			fmt.Fprintf(stderr, "%s payload failed validation:\n", validationErr.Event)
+			for _, f := range validationErr.Fields {
+				fmt.Fprintf(stderr, "  %s: %s\n", f.Field, f.Message)
+			}
+		case errors.As(err, &apiErr):
+			fmt.Fprintln(stderr, "invalid payload:", apiErr.Message)
+		default:
+			fmt.Fprintln(stderr, "invalid payload:", err)
+		}
+		return 1
+	}
+
+	if res.Outcome == outcomeIgnored {
+		fmt.Fprintf(stderr, "no handler for event %q, it would be acknowledged and dropped\n", res.Event)
+		return 1
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res.Body); err != nil {
+		fmt.Fprintln(stderr, "error encoding result:", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes one field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by event handlers when a payload parses fine
+// but is missing required fields or carries invalid values, it maps to a 422
+type ValidationError struct {
+	Event  string
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+
+	return fmt.Sprintf("invalid %s payload: %s", e.Event, strings.Join(msgs, "; "))
+}
+
+// validator collects field errors so a payload reports all of them at once
+type validator struct {
+	fields []FieldError
+}
+
+// check records msg against field unless ok holds
+func (v *validator) check(ok bool, field, msg string) {
+	if !ok {
+		v.fields = append(v.fields, FieldError{Field: field, Message: msg})
+	}
+}
+
+// status checks that value is a status we know and one of allowed
+func (v *validator) status(value PaymentStatus, field string, allowed ...PaymentStatus) {
+	switch {
+	case value == "":
+		v.check(false, field, "is required")
+		return
+	case !value.Known():
+		v.check(false, field, fmt.Sprintf("unknown status %q", value))
+		return
+	}
+
+	names := make([]string, len(allowed))
+	for i, a := range allowed {
+		if value == a {
+			return
+		}
+		names[i] = string(a)
+	}
+
+	v.check(false, field, fmt.Sprintf("must be one of %s, got %q", strings.Join(names, ", "), value))
+}
+
+// err returns a *ValidationError for event, or nil when every check passed
+func (v *validator) err(event string) error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Event: event, Fields: v.fields}
+}
+
+// CurrencyAllowList holds the currencies we accept payments in, an empty
+// list accepts every currency
+type CurrencyAllowList map[string]bool
+
+// parseCurrencyAllowList reads a comma separated list like "NGN, usd"
+func parseCurrencyAllowList(s string) CurrencyAllowList {
+	allowed := CurrencyAllowList{}
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.ToUpper(strings.TrimSpace(c)); c != "" {
+			allowed[c] = true
+		}
+	}
+
+	return allowed
+}
+
+// check returns a *ValidationError when currency isn't allowed
+func (c CurrencyAllowList) check(event, currency string) error {
+	if len(c) == 0 || c[strings.ToUpper(currency)] {
+		return nil
+	}
+
+	var v validator
+	v.check(false, "data.currency", fmt.Sprintf("currency %q is not accepted", currency))
+
+	return v.err(event)
+}
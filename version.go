@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// version, commit and builtAt are stamped in at build time, e.g.
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.builtAt=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "dev"
+	commit  = "dev"
+	builtAt = "dev"
+)
+
+// startTime is when the process started, main sets it first thing
+var startTime = time.Now()
+
+// buildInfo describes the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+	Uptime    string `json:"uptime"`
+}
+
+// versionInfo is the /version body
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuiltAt   string `json:"built_at"`
+	GoVersion string `json:"go_version"`
+}
+
+// VersionHandler serves the build metadata on its own, for tooling that
+// only wants to know what's deployed
+func VersionHandler(l *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, l, http.StatusOK, versionInfo{Version: version, Commit: commit, BuiltAt: builtAt, GoVersion: runtime.Version()})
+	}
+}
+
+func currentBuildInfo(now time.Time) buildInfo {
+	return buildInfo{
+		Version:   version,
+		Commit:    commit,
+		GoVersion: runtime.Version(),
+		Uptime:    now.Sub(startTime).Round(time.Second).String(),
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// Result is what ProcessWebhook did with a delivery. Event is only set once
+// the payload got past parsing, the HandlerResult is what goes back to the
+// sender
+type Result struct {
+	Event   string
+	Outcome string
+	HandlerResult
+}
+
+// outcomes a delivery can end in, they show up in dry run reports
+const (
+	outcomeProcessed = "processed"
+	outcomeIgnored   = "ignored"
+	outcomeDuplicate = "duplicate"
+)
+
+// errPanic is wrapped by the error ProcessWebhook returns when it recovered
+// from a panic
+var errPanic = errors.New("panic")
+
+// WebhookProcessor runs a verified delivery through everything after the
+// HTTP layer: parsing, persistence, deduplication, the event handler and the
+// subscribers. it knows nothing about requests so it can be driven directly
+type WebhookProcessor struct {
+	l           *slog.Logger
+	router      *EventRouter
+	idempotency IdempotencyStore
+	store       EventStore
+	ageCheck    EventAgeCheck
+	dispatcher  *Dispatcher
+	clock       Clock
+	// forwardPolicy is ackAlways or ackOnSuccess
+	forwardPolicy string
+}
+
+func NewWebhookProcessor(l *slog.Logger, router *EventRouter, idempotency IdempotencyStore, store EventStore, ageCheck EventAgeCheck, dispatcher *Dispatcher, clock Clock, forwardPolicy string) *WebhookProcessor {
+	return &WebhookProcessor{
+		l:             l,
+		router:        router,
+		idempotency:   idempotency,
+		store:         store,
+		ageCheck:      ageCheck,
+		dispatcher:    dispatcher,
+		clock:         clock,
+		forwardPolicy: forwardPolicy,
+	}
+}
+
+// delivery is what the HTTP layer knows about a webhook that the payload
+// doesn't say, it travels in the context like the dry run flag
+type delivery struct {
+	provider  string
+	eventName func(body []byte) (string, error)
+}
+
+type deliveryKey struct{}
+
+func withDelivery(ctx context.Context, d delivery) context.Context {
+	return context.WithValue(ctx, deliveryKey{}, d)
+}
+
+// deliveryFromContext falls back to reading the top level event field, which
+// is what paystack and most other senders do
+func deliveryFromContext(ctx context.Context) delivery {
+	d, _ := ctx.Value(deliveryKey{}).(delivery)
+	if d.eventName == nil {
+		d.eventName = defaultEventNamePath.EventName
+	}
+
+	return d
+}
+
+// ProcessWebhook handles the raw payload of a delivery that was already
+// verified. stage failures come back as an APIError, anything else came from
+// the event handler and is mapped by writeHandlerError
+func (p *WebhookProcessor) ProcessWebhook(ctx context.Context, raw []byte) (res Result, err error) {
+	// Recover only covers requests, callers driving the processor directly
+	// get a panic in a handler or decoder back as an error instead
+	defer func() {
+		if v := recover(); v != nil {
+			p.l.Error("panic while processing webhook", "panic", v, "stack", string(debug.Stack()))
+			res, err = Result{Event: res.Event}, fmt.Errorf("processing webhook: %w: %v", errPanic, v)
+		}
+	}()
+
+	d := deliveryFromContext(ctx)
+	dryRun := isDryRun(ctx)
+	l := p.l.With("request_id", requestIDFromContext(ctx))
+	if d.provider != "" {
+		l = l.With("provider", d.provider)
+	}
+
+	// End is safe to call twice, the defer covers the early returns
+	_, parseSpan := startSpan(ctx, "webhook.parse")
+	parseSpan.SetAttribute("webhook.provider", d.provider)
+	defer parseSpan.End()
+
+	eventName, err := d.eventName(raw)
+	if err != nil {
+		parseSpan.RecordError(err)
+		l.Info("error unmarshalling json data message", "error context", err)
+		if errors.Is(err, ErrInvalidEvent) {
+			return Result{}, APIError{Code: ackPolicy(err), Message: "missing or invalid event"}
+		}
+		return Result{}, APIError{Code: ackPolicy(err), Message: "invalid JSON payload"}
+	}
+
+	parseSpan.SetAttribute("webhook.event", eventName)
+	parseSpan.End()
+
+	res = Result{Event: eventName}
+
+	if !dryRun {
+		stored := StoredEvent{
+			ID:             newUUID(),
+			Event:          eventName,
+			Raw:            raw,
+			ReceivedAt:     p.clock.Now().UTC(),
+			SignatureValid: true,
+		}
+		ctx, persistSpan := startSpan(ctx, "webhook.persist")
+		persistSpan.SetAttribute("webhook.event", eventName)
+		err := p.store.Save(ctx, stored)
+		persistSpan.RecordError(err)
+		persistSpan.End()
+
+		if err != nil {
+			if isContextError(err) {
+				return res, err
+			}
+
+			l.Error("error saving received event", "event", eventName, "error context", err)
+			return res, APIError{Code: ackPolicy(err), Message: "error saving event"}
+		}
+	}
+
+	handler, ok := p.router.Lookup(eventName)
+	if !ok {
+		// senders treat anything but a 2xx as a failed delivery and retry,
+		// so events we don't care about are acknowledged and dropped
+		l.Info("no event type found, ignoring", "response event title", eventName)
+
+		res.Outcome, res.HandlerResult = outcomeIgnored, handled(map[string]string{"status": "ignored", "event": eventName})
+		return res, nil
+	}
+
+	// only events we act on are held to the age window, an old event we'd
+	// ignore anyway still gets its 200 so the sender stops retrying it
+	if err := p.ageCheck.Check(raw); err != nil {
+		l.Info("rejected webhook outside the allowed age window", "event", eventName, "error context", err)
+		return res, APIError{Code: ackPolicy(err), Message: err.Error()}
+	}
+
+	key := payloadIdempotencyKey(eventName, raw)
+	if key != "" {
+		seen, err := p.idempotency.Seen(key)
+		if err != nil {
+			l.Error("error checking idempotency key", "key", key, "error context", err)
+			return res, APIError{Code: ackPolicy(err), Message: "error checking idempotency key"}
+		}
+
+		if seen {
+			l.Info("duplicate delivery, skipping", "event", eventName, "key", key)
+
+			res.Outcome, res.HandlerResult = outcomeDuplicate, handled(map[string]string{"status": "duplicate", "event": eventName})
+			return res, nil
+		}
+	}
+
+	handleCtx, handleSpan := startSpan(ctx, "webhook.handle")
+	handleSpan.SetAttribute("webhook.event", eventName)
+	result, err := handler(handleCtx, raw)
+	handleSpan.RecordError(err)
+	handleSpan.End()
+
+	// under ack-always a failed forward is ours to sort out, the event was
+	// still handled and is in the store to be replayed. a forward cut short
+	// by our own deadline or the sender hanging up never reached the queue
+	// though, acknowledging it would turn the sender's retry into a
+	// duplicate and lose the event
+	var fwdErr *ForwardError
+	if errors.As(err, &fwdErr) && p.forwardPolicy != ackOnSuccess && !isContextError(fwdErr.Err) {
+		l.Error("event handled but not forwarded, acknowledging anyway", "event", eventName, "error context", fwdErr.Err)
+		result, err = fwdErr.Result, nil
+	}
+
+	if err != nil {
+		return res, err
+	}
+
+	if key != "" && !dryRun {
+		p.idempotency.Mark(key)
+	}
+
+	// subscribers failing is our problem, not the sender's, so the
+	// delivery is still acknowledged
+	if ev, ok := result.Body.(NormalizedEvent); ok && !dryRun {
+		if err := p.dispatcher.Dispatch(ctx, ev); err != nil {
+			l.Warn("event handled but not every subscriber got it", "event", eventName, "error context", err)
+		}
+	}
+
+	res.Outcome, res.HandlerResult = outcomeProcessed, result
+	return res, nil
+}
+
+// writeProcessError answers a delivery ProcessWebhook failed on
+func writeProcessError(w http.ResponseWriter, l *slog.Logger, event string, err error) {
+	var apiErr APIError
+	if errors.As(err, &apiErr) {
+		writeError(w, l, apiErr)
+		return
+	}
+
+	writeHandlerError(w, l, event, err)
+}
+
+// isContextError reports whether err comes from a context running out or
+// being cancelled rather than from the work itself
+func isContextError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
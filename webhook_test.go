@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// loadFixtures reads testdata/events, one payload per event we handle keyed
+// by the event name
+func loadFixtures(tb testing.TB) map[string][]byte {
+	tb.Helper()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "events", "*.json"))
+	if err != nil || len(paths) == 0 {
+		tb.Fatalf("no fixtures in testdata/events: %v", err)
+	}
+
+	fixtures := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatalf("reading fixture: %v", err)
+		}
+		fixtures[strings.TrimSuffix(filepath.Base(path), ".json")] = raw
+	}
+
+	return fixtures
+}
+
+func sortedEvents(fixtures map[string][]byte) []string {
+	events := make([]string, 0, len(fixtures))
+	for event := range fixtures {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	return events
+}
+
+// nopIdempotency never sees a key, so a benchmark can send the same
+// delivery over and over
+type nopIdempotency struct{}
+
+func (nopIdempotency) Seen(string) (bool, error) { return false, nil }
+func (nopIdempotency) Mark(string)               {}
+
+// nopStore forgets everything it is given
+type nopStore struct{}
+
+func (nopStore) Save(context.Context, StoredEvent) error { return nil }
+func (nopStore) Get(context.Context, string) (StoredEvent, error) {
+	return StoredEvent{}, ErrEventNotFound
+}
+func (nopStore) List(context.Context, Filter) ([]StoredEvent, error) { return nil, nil }
+
+// stubForwarder fails every forward with err, or accepts them when it's nil
+type stubForwarder struct {
+	err   error
+	calls int
+}
+
+func (f *stubForwarder) Forward(context.Context, string, any) error {
+	f.calls++
+	return f.err
+}
+
+// newTestProcessor wires a processor the way the server does, with memory
+// stores so a test can look at what was kept
+func newTestProcessor(fwd Forwarder, forwardPolicy string) (*WebhookProcessor, *MemoryEventStore) {
+	l := discardLogger()
+	store := NewMemoryEventStore(100)
+	idempotency := NewMemoryIdempotencyStore(realClock{}, time.Hour)
+
+	return NewWebhookProcessor(l, newEventRouter(Config{}, l, fwd), idempotency, store, EventAgeCheck{}, NewDispatcher(l), realClock{}, forwardPolicy), store
+}
+
+func storedEvents(t *testing.T, store *MemoryEventStore) []StoredEvent {
+	t.Helper()
+
+	events, err := store.List(context.Background(), Filter{})
+	if err != nil {
+		t.Fatalf("listing stored events: %v", err)
+	}
+
+	return events
+}
+
+func TestProcessWebhookEvents(t *testing.T) {
+	fixtures := loadFixtures(t)
+
+	for _, event := range sortedEvents(fixtures) {
+		t.Run(event, func(t *testing.T) {
+			p, store := newTestProcessor(&stubForwarder{}, ackAlways)
+
+			res, err := p.ProcessWebhook(context.Background(), fixtures[event])
+			if err != nil {
+				t.Fatalf("processing: %v", err)
+			}
+			if res.Event != event || res.Outcome != outcomeProcessed || res.Status != http.StatusOK {
+				t.Errorf("got event %q outcome %q status %d, want %q processed 200", res.Event, res.Outcome, res.Status, event)
+			}
+
+			stored := storedEvents(t, store)
+			if len(stored) != 1 || stored[0].Event != event || !bytes.Equal(stored[0].Raw, fixtures[event]) {
+				t.Errorf("stored %+v, want the one delivery", stored)
+			}
+		})
+	}
+}
+
+func TestProcessWebhookRejects(t *testing.T) {
+	fixtures := loadFixtures(t)
+
+	tests := []struct {
+		name     string
+		raw      []byte
+		wantCode int
+		stored   bool
+	}{
+		{"invalid json", []byte(`{"event":`), http.StatusBadRequest, false},
+		{"missing event", []byte(`{"data":{}}`), http.StatusBadRequest, false},
+		{"event not a string", []byte(`{"event":42}`), http.StatusBadRequest, false},
+		{"fails validation", bytes.Replace(fixtures["charge.success"], []byte(`"reference": "qTPrJoy9Bx"`), []byte(`"reference": ""`), 1), http.StatusUnprocessableEntity, true},
+		{"unreadable data", []byte(`{"event":"charge.success","data":"nope"}`), http.StatusBadRequest, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store := newTestProcessor(nil, ackAlways)
+
+			_, err := p.ProcessWebhook(context.Background(), tt.raw)
+			if err == nil {
+				t.Fatal("processed, want an error")
+			}
+
+			code := ackPolicy(err)
+			var apiErr APIError
+			if errors.As(err, &apiErr) {
+				code = apiErr.Code
+			}
+			if code != tt.wantCode {
+				t.Errorf("answered %d (%v), want %d", code, err, tt.wantCode)
+			}
+
+			// a delivery we could read is kept even when its handler fails,
+			// so it can be replayed once the cause is fixed
+			if got := len(storedEvents(t, store)) == 1; got != tt.stored {
+				t.Errorf("stored: %v, want %v", got, tt.stored)
+			}
+		})
+	}
+}
+
+func TestProcessWebhookIgnoresUnknownEvents(t *testing.T) {
+	p, store := newTestProcessor(nil, ackAlways)
+
+	res, err := p.ProcessWebhook(context.Background(), []byte(`{"event":"transfer.success","data":{"id":1}}`))
+	if err != nil {
+		t.Fatalf("processing: %v", err)
+	}
+	if res.Outcome != outcomeIgnored || res.Status != http.StatusOK {
+		t.Errorf("got outcome %q status %d, want ignored 200", res.Outcome, res.Status)
+	}
+	if len(storedEvents(t, store)) != 1 {
+		t.Error("ignored event wasn't stored")
+	}
+}
+
+func TestProcessWebhookDuplicate(t *testing.T) {
+	raw := loadFixtures(t)["charge.success"]
+	fwd := &stubForwarder{}
+	p, _ := newTestProcessor(fwd, ackAlways)
+
+	for i, want := range []string{outcomeProcessed, outcomeDuplicate} {
+		res, err := p.ProcessWebhook(context.Background(), raw)
+		if err != nil {
+			t.Fatalf("delivery %d: %v", i+1, err)
+		}
+		if res.Outcome != want {
+			t.Errorf("delivery %d: got outcome %q, want %q", i+1, res.Outcome, want)
+		}
+	}
+
+	if fwd.calls != 1 {
+		t.Errorf("forwarded %d times, want once", fwd.calls)
+	}
+}
+
+func TestProcessWebhookInvoiceUpdates(t *testing.T) {
+	success := loadFixtures(t)["invoice.update"]
+	pending := bytes.Replace(success, []byte(`"status": "success"`), []byte(`"status": "pending"`), 1)
+	p, _ := newTestProcessor(nil, ackAlways)
+
+	// the same invoice updated twice, then the sender retrying the second
+	for i, step := range []struct {
+		raw  []byte
+		want string
+	}{
+		{pending, outcomeProcessed},
+		{success, outcomeProcessed},
+		{success, outcomeDuplicate},
+	} {
+		res, err := p.ProcessWebhook(context.Background(), step.raw)
+		if err != nil {
+			t.Fatalf("update %d: %v", i+1, err)
+		}
+		if res.Outcome != step.want {
+			t.Errorf("update %d: got outcome %q, want %q", i+1, res.Outcome, step.want)
+		}
+	}
+}
+
+func TestProcessWebhookForwardFailure(t *testing.T) {
+	raw := loadFixtures(t)["charge.success"]
+	refused := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		policy   string
+		err      error
+		wantCode int
+	}{
+		{"ack always", ackAlways, refused, http.StatusOK},
+		{"ack on success", ackOnSuccess, refused, http.StatusBadGateway},
+		// the forward never reached the queue, acknowledging it would lose
+		// the event
+		{"ack always timed out", ackAlways, fmt.Errorf("sending: %w", context.DeadlineExceeded), http.StatusServiceUnavailable},
+		{"ack always sender gone", ackAlways, context.Canceled, statusClientClosedRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestProcessor(&stubForwarder{err: tt.err}, tt.policy)
+
+			res, err := p.ProcessWebhook(context.Background(), raw)
+			if code := ackPolicy(err); code != tt.wantCode {
+				t.Fatalf("answered %d (%v), want %d", code, err, tt.wantCode)
+			}
+
+			if err != nil {
+				var fwdErr *ForwardError
+				if !errors.As(err, &fwdErr) {
+					t.Errorf("got %v, want a ForwardError", err)
+				}
+				return
+			}
+			if res.Outcome != outcomeProcessed {
+				t.Errorf("got outcome %q, want processed", res.Outcome)
+			}
+		})
+	}
+}
+
+func TestProcessWebhookRetryAfterFailedForward(t *testing.T) {
+	raw := loadFixtures(t)["charge.success"]
+	fwd := &stubForwarder{err: errors.New("connection refused")}
+	p, _ := newTestProcessor(fwd, ackOnSuccess)
+
+	if _, err := p.ProcessWebhook(context.Background(), raw); err == nil {
+		t.Fatal("first delivery processed, want the forward error")
+	}
+
+	// the sender's retry has to be handled again, not taken for a duplicate
+	fwd.err = nil
+	res, err := p.ProcessWebhook(context.Background(), raw)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if res.Outcome != outcomeProcessed || fwd.calls != 2 {
+		t.Errorf("retry got outcome %q after %d forwards, want processed after 2", res.Outcome, fwd.calls)
+	}
+}
+
+func TestProcessWebhookDryRun(t *testing.T) {
+	raw := loadFixtures(t)["paymentrequest.success"]
+	fwd := &stubForwarder{}
+	p, store := newTestProcessor(fwd, ackAlways)
+
+	for i := 0; i < 2; i++ {
+		res, err := p.ProcessWebhook(withDryRun(context.Background()), raw)
+		if err != nil {
+			t.Fatalf("dry run %d: %v", i+1, err)
+		}
+		// nothing is marked either, so the second run isn't a duplicate
+		if res.Outcome != outcomeProcessed {
+			t.Errorf("dry run %d: got outcome %q, want processed", i+1, res.Outcome)
+		}
+	}
+
+	if n := len(storedEvents(t, store)); n != 0 {
+		t.Errorf("dry run stored %d events", n)
+	}
+	if fwd.calls != 0 {
+		t.Errorf("dry run forwarded %d times", fwd.calls)
+	}
+}
+
+// FuzzProcessWebhook throws mangled deliveries at the processor. whatever
+// comes in, it has to end in an outcome or an error that maps to a status,
+// never a recovered panic
+func FuzzProcessWebhook(f *testing.F) {
+	fixtures := loadFixtures(f)
+	for _, event := range sortedEvents(fixtures) {
+		f.Add(fixtures[event])
+	}
+	for _, seed := range []string{
+		``,
+		`null`,
+		`[]`,
+		`{"event":null}`,
+		`{"event":"charge.success"}`,
+		`{"event":"charge.success","data":null}`,
+		`{"event":"charge.success","data":{"amount":1e-999999}}`,
+		`{"event":"charge.success","data":{"amount":99999999999999999999999}}`,
+		`{"event":"invoice.create","data":{"metadata":"\xff"}}`,
+		`{"event":"paymentrequest.success","data":` + strings.Repeat(`[`, 10000) + `}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	l := discardLogger()
+	p := NewWebhookProcessor(l, newEventRouter(Config{}, l, &stubForwarder{}), nopIdempotency{}, nopStore{}, EventAgeCheck{}, NewDispatcher(l), realClock{}, ackAlways)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		res, err := p.ProcessWebhook(context.Background(), raw)
+		if errors.Is(err, errPanic) {
+			t.Fatalf("processing %q: %v", raw, err)
+		}
+
+		if err == nil && res.Outcome == "" {
+			t.Fatalf("processing %q: no error and no outcome", raw)
+		}
+	})
+}
+
+func BenchmarkProcessWebhook(b *testing.B) {
+	fixtures := loadFixtures(b)
+
+	l := discardLogger()
+	p := NewWebhookProcessor(l, newEventRouter(Config{}, l, nil), nopIdempotency{}, nopStore{}, EventAgeCheck{}, NewDispatcher(l), realClock{}, ackAlways)
+
+	for _, event := range sortedEvents(fixtures) {
+		raw := fixtures[event]
+
+		b.Run(event, func(b *testing.B) {
+			b.ReportAllocs()
+			ctx := context.Background()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := p.ProcessWebhook(ctx, raw); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}